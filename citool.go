@@ -4,167 +4,776 @@ import (
 	"flag"
 	"fmt"
 	"github.com/ashishb/ci-analysis-tool/src/citool"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"regexp"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
-var mode = flag.String("mode",
+var downloadFlags = flag.NewFlagSet("download", flag.ExitOnError)
+
+var analyzeFlags = flag.NewFlagSet("analyze", flag.ExitOnError)
+
+var validateFlags = flag.NewFlagSet("validate", flag.ExitOnError)
+
+var versionFlags = flag.NewFlagSet("version", flag.ExitOnError)
+
+var configFlags = flag.NewFlagSet("config", flag.ExitOnError)
+
+// Flags of these commands, if not set on the command line, are set from the environment and the config.
+var configurableFlagSets = []*flag.FlagSet{downloadFlags, analyzeFlags}
+
+// Flags common to the download and the analyze commands, see addCommonFlags.
+var username = new(string)
+var repositoryName = new(string)
+var branchName = new(string)
+var jobStatus = new(string)
+var debugMode = new(bool)
+var logLevel = new(string)
+var logFormat = new(string)
+
+// Flag common to the analyze and the validate commands, see addInputFlags.
+var inputFiles = new(string)
+
+// Flags selecting the config file and the profile, see addConfigFlags.
+var configFile = new(string)
+var profileName = new(string)
+
+var maxListedIssues = validateFlags.Int("max-issues",
+	10,
+	"Maximum number of the issues listed per file, the rest are only counted.")
+
+var jobname = analyzeFlags.String("jobname",
+	"",
+	"Only consider job results for this jobname.")
+
+var provider = downloadFlags.String("provider",
+	"circleci",
+	"CI provider to download from - \"circleci\", \"gitlab\", \"jenkins\" or \"buildkite\".")
+
+var gitLabURL = downloadFlags.String("gitlab-url",
+	citool.DefaultGitLabURL,
+	"Base URL of the GitLab instance.")
+
+var gitLabToken = downloadFlags.String("gitlab-token",
+	"",
+	"GitLab private access token.")
+
+var jenkinsURL = downloadFlags.String("jenkins-url",
 	"",
-	"Mode - \"download\" or \"analyze\"")
+	"Base URL of the Jenkins server.")
 
-var jobname = flag.String("jobname",
+var jenkinsUser = downloadFlags.String("jenkins-user",
 	"",
-	"Only consider job results for this jobname. Analyze mode only.")
+	"Jenkins user name.")
 
-var jobStatus = flag.String("jobstatus",
+var jenkinsToken = downloadFlags.String("jenkins-token",
 	"",
-	"Only consider job results with this completion status. Analyze mode only.")
+	"Jenkins API token of the user.")
 
-var inputFiles = flag.String("input-files",
+var jenkinsJob = downloadFlags.String("jenkins-job",
 	"",
-	"Comma-separated list of files containing downloaded job results from CircleCI. Analyze mode only.")
+	"Slash-separated path of the Jenkins job, folder or multibranch pipeline.")
+
+var buildkiteURL = downloadFlags.String("buildkite-url",
+	citool.DefaultBuildkiteURL,
+	"Base URL of the Buildkite REST API.")
+
+var buildkiteToken = downloadFlags.String("buildkite-token",
+	"",
+	"Buildkite API access token, use username for organization and reponame for pipeline.")
+
+var circleCiURL = downloadFlags.String("circle-url",
+	citool.DefaultCircleCiURL,
+	"Base URL of the Circle CI API.")
 
-var circleCiToken = flag.String("circle-token",
+var circleCiToken = downloadFlags.String("circle-token",
 	"",
-	"Circle CI access token. Download mode only.")
+	"Circle CI access token, prefer CIRCLE_TOKEN, -circle-token-file or -circle-token-command to keep it out of the shell history.")
 
-var downloadStartOffset = flag.Int("offset",
+var circleCiTokenFile = downloadFlags.String("circle-token-file",
+	"",
+	"File containing the Circle CI access token.")
+
+var circleCiTokenCommand = downloadFlags.String("circle-token-command",
+	"",
+	"Credential helper command printing the Circle CI access token, like \"pass show circleci\".")
+
+var downloadStartOffset = downloadFlags.Int("offset",
 	defaultStartOffset,
 	fmt.Sprintf("Circle CI build results download start offset (Default: %d)", defaultStartOffset))
 
-var downloadLimit = flag.Int("limit",
+var downloadLimit = downloadFlags.Int("limit",
 	defaultDownloadLimit,
 	fmt.Sprintf("Circle CI build results download limit (Default: %d)", defaultDownloadLimit))
 
-var vcsType = flag.String("vcsType",
+var vcsType = downloadFlags.String("vcsType",
 	"github",
-	"Name of the VCS system - See https://circleci.com/docs/api/#version-control-systems-vcs-type. Download mode only.")
+	"Name of the VCS system - See https://circleci.com/docs/api/#version-control-systems-vcs-type.")
+
+var downloadTests = downloadFlags.Bool("download-tests",
+	false,
+	"Download test metadata of every finished build to the \"tests\" sub-directory of the download directory.")
 
-var username = flag.String("username",
+var deepDownload = downloadFlags.Bool("deep",
+	false,
+	"Download the full build results instead of the shallow ones.")
+
+var downloadBuildDetails = downloadFlags.Bool("download-build-details",
+	false,
+	"Fetch every finished build individually to get the build details like the step durations.")
+
+var downloadFailureLogs = downloadFlags.Bool("download-failure-logs",
+	false,
+	"Download output of the failed steps of the failed, timed out and infrastructure failed builds to the \"logs\" sub-directory "+
+		"of the download directory, requires -download-build-details.")
+
+var testResultsDir = analyzeFlags.String("test-results-dir",
 	"",
-	"Optional username to filter downloads/analysis on",
-)
+	"Directory containing test results keyed by build number, either \"<build number>/**/*.xml\" JUnit XML files or \"<username>/<reponame>/<build number>.json\" files from the download command.")
+
+var printFailureBreakdown = analyzeFlags.Bool("print-failure-breakdown",
+	false,
+	"Print per-job breakdown of all the job statuses into code failures, infra failures, timeouts and cancellations.")
+
+var printJobRecovery = analyzeFlags.Bool("print-recovery",
+	false,
+	"Print per-job number of breakages, mean/max time to recovery and the longest failure streak for every branch.")
+
+var printDoraMetrics = analyzeFlags.Bool("print-dora",
+	false,
+	"Print DORA metrics - deployment frequency, lead time, change failure rate and time to restore.")
 
-var repositoryName = flag.String("reponame",
+var deployJobPattern = analyzeFlags.String("deploy-job-pattern",
+	citool.DefaultDeployJobPattern,
+	"Regular expression matching the names of the deploy jobs, used with -print-dora.")
+
+var costModelFile = analyzeFlags.String("cost-model",
 	"",
-	"Optional repository name to filter downloads/analysis on")
+	"JSON file containing credits per minute per resource class/platform, prints estimated cost per job, workflow, branch and user.")
+
+var printAuthorStats = analyzeFlags.Bool("print-authors",
+	false,
+	"Print per-author number of jobs, failure rate, average time to green and compute consumed.")
+
+var printPullRequests = analyzeFlags.Bool("print-pull-requests",
+	false,
+	"Print per-pull request number of CI runs, attempts till the first fully green workflow, wall-clock time and credits consumed.")
+
+var printConcurrency = analyzeFlags.Bool("print-concurrency",
+	false,
+	"Print peak and p95 number of running and queued jobs per day and their timeline graphs.")
 
-var branchName = flag.String("branch",
+var printHeatmaps = analyzeFlags.Bool("print-heatmaps",
+	false,
+	"Print weekday x hour heatmaps of number of jobs, failure rate and median duration.")
+
+var timeZone = analyzeFlags.String("time-zone",
+	"UTC",
+	"Time zone, like \"America/Los_Angeles\", used for the heatmaps and the daily concurrency.")
+
+var heatmapFile = analyzeFlags.String("heatmap-file",
 	"",
-	"Optional branch name to filter download/analysis on")
+	"If set, heatmap cells are written to this file as JSON.")
+
+var authorKey = analyzeFlags.String("author-key",
+	string(citool.AuthorKeyLogin),
+	"Identify authors by - \"login\" of the user who triggered the build, commit \"author\" name or \"committer\" email.")
+
+var anonymizeAuthors = analyzeFlags.Bool("anonymize",
+	false,
+	"Replace the author names with \"author-1\", \"author-2\" etc. in the per-author report for sharing.")
 
-var downloadDirPath = flag.String("download-dir",
+var failureStatuses = analyzeFlags.String("failure-statuses",
+	string(citool.JobStatusFailed),
+	"Comma-separated list of job statuses which count against the success rate.")
+
+var printTestStats = analyzeFlags.Bool("print-test-stats",
+	false,
+	"Print per-test failure rate, flakiness and duration percentiles, requires -test-results-dir.")
+
+var printStepDurations = analyzeFlags.Bool("print-step-durations",
+	false,
+	"Print per-job step duration percentiles, requires the data downloaded with -download-build-details.")
+
+var failureRulesFile = analyzeFlags.String("failure-rules",
+	"",
+	"JSON file containing the failure categories and their regular expressions, prints the failure counts per category per job "+
+		"of the jobs with the -failure-statuses.")
+
+var failureLogsDir = analyzeFlags.String("failure-logs-dir",
+	"",
+	"Directory containing the output of the failed steps as \"<username>/<reponame>/<build number>.txt\" or \"<build number>.txt\" files, required with -failure-rules.")
+
+var printFlakyTests = analyzeFlags.Bool("print-flaky-tests",
+	false,
+	"Print tests ranked by how often they flip between pass and fail on the same revision, requires -test-results-dir.")
+
+var quarantineFile = analyzeFlags.String("quarantine-file",
+	"",
+	"Write the names of the flaky tests to this file, one per line, requires -test-results-dir.")
+
+var downloadDirPath = downloadFlags.String("download-dir",
 	defaultDownloadDir,
 	"Directory to download Circle CI data to")
 
-var printJobSuccessRate = flag.Bool("print-success-rate",
-	true,
-	"Print per-job aggregated success rate. Analyze mode only.")
+var outputTemplate = downloadFlags.String("output-template",
+	citool.DefaultOutputTemplate,
+	"Path of the downloaded pages relative to -download-dir with the placeholders {provider}, {vcs}, {username}, "+
+		"{repo}, {branch}, {date}, {start} and {end}, like \"{vcs}/{username}/{repo}/{branch}/{date}/page-{start}.json\". "+
+		"{date} is the date of the download, not of the builds, so downloading again on another day writes the same builds again.")
 
-var printJobDuration = flag.Bool("print-duration",
-	true,
-	"Print per-job average duration. Analyze mode only.")
+var downloadCompression = downloadFlags.String("compress",
+	string(citool.CompressionNone),
+	"Compression of the downloaded pages, one of none, gzip or zstd.")
 
-var printJobDurationTimeSeries = flag.Bool("print-duration-graph",
+var printJobSuccessRate = analyzeFlags.Bool("print-success-rate",
 	true,
-	"Print per-job duration time series graph (yes, a graph). Analyze mode only.")
+	"Print per-job aggregated success rate.")
 
-var printJobSuccessTimeSeries = flag.Bool("print-success-graph",
-	false,
-	"Print per-job success graph (yes, a graph). Analyze mode only.")
+var printJobDuration = analyzeFlags.Bool("print-duration",
+	true,
+	"Print per-job average duration.")
 
-var debugMode = flag.Bool("debug",
-	false,
-	"Set this to true to enable debug logging")
+var printJobDurationTimeSeries = analyzeFlags.Bool("print-duration-graph",
+	true,
+	"Print per-job duration time series graph (yes, a graph).")
 
-var version = flag.Bool("version",
+var printJobSuccessTimeSeries = analyzeFlags.Bool("print-success-graph",
 	false,
-	"Prints version of this tool")
+	"Print per-job success graph (yes, a graph).")
 
 const versionString = "0.1.0"
 const defaultDownloadDir = "./circleci_data"
 const defaultStartOffset = 0
 const defaultDownloadLimit = 100
 
+// command is a sub-command of the tool like "citool analyze".
+type command struct {
+	name        string
+	description string
+	// Usage of the positional arguments, if any.
+	argsUsage string
+	flagSet   *flag.FlagSet
+	examples  []string
+	run       func(args []string)
+}
+
+var commands = []command{
+	{
+		name:        "download",
+		description: "Download job results from the CI provider",
+		flagSet:     downloadFlags,
+		examples: []string{
+			"citool download --circle-token ${TOKEN} --username ashishb --reponame androidtool --download-dir androidtool_data",
+			"citool download --provider gitlab --gitlab-token ${TOKEN} --username mygroup --reponame myproject",
+		},
+		run: download,
+	},
+	{
+		name:        "analyze",
+		description: "Analyze the downloaded job results",
+		argsUsage:   "[files...]",
+		flagSet:     analyzeFlags,
+		examples: []string{
+			"citool analyze androidtool_data/*.json",
+			"citool analyze --branch master --print-recovery --print-duration-graph=false androidtool_data/*.json",
+			"jq -c '.[] | select(.branch == \"master\")' androidtool_data/*.json | citool analyze -",
+		},
+		run: analyze,
+	},
+	{
+		name:        "validate",
+		description: "Check the job results against the expected schema and print the data quality per file",
+		argsUsage:   "[files...]",
+		flagSet:     validateFlags,
+		examples: []string{
+			"citool validate androidtool_data",
+			"citool validate --max-issues 100 androidtool_data/from-0-to-99.json",
+		},
+		run: validateInputFiles,
+	},
+	{
+		name:        "config",
+		description: "Print the settings resolved from the flags, the environment and the config file",
+		argsUsage:   "show",
+		flagSet:     configFlags,
+		examples: []string{
+			"citool config show --profile celo",
+		},
+		run: showConfig,
+	},
+	{
+		name:        "version",
+		description: "Print version of this tool",
+		flagSet:     versionFlags,
+		run: func(args []string) {
+			fmt.Printf("%s\n", versionString)
+		},
+	},
+}
+
+func init() {
+	addCommonFlags(downloadFlags)
+	addCommonFlags(analyzeFlags)
+	addInputFlags(analyzeFlags)
+	addInputFlags(validateFlags)
+	addConfigFlags(downloadFlags)
+	addConfigFlags(analyzeFlags)
+	addConfigFlags(configFlags)
+	for i := range commands {
+		cmd := commands[i]
+		cmd.flagSet.Usage = func() { printCommandUsage(cmd) }
+	}
+}
+
+func addCommonFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(username, "username", "", "Optional username to filter downloads/analysis on")
+	flagSet.StringVar(repositoryName, "reponame", "", "Optional repository name to filter downloads/analysis on")
+	flagSet.StringVar(branchName, "branch", "", "Optional branch name to filter download/analysis on")
+	flagSet.StringVar(jobStatus, "jobstatus", "", "Only consider job results with this completion status.")
+	flagSet.BoolVar(debugMode, "debug", false, "Set this to true to enable debug logging, same as -log-level debug")
+	flagSet.StringVar(logLevel, "log-level", "info", "Minimum level of the logs written to stderr - \"debug\", \"info\", \"warn\" or \"error\"")
+	flagSet.StringVar(logFormat, "log-format", citool.LogFormatText, "Format of the logs - \"text\" or \"json\"")
+}
+
+func addInputFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(inputFiles, "input-files", "",
+		"Comma-separated list of files, directories or glob patterns of the downloaded job results. "+
+			"Gzip or zstd compressed files and tar archives are read as well, "+
+			"either JSON arrays or newline-delimited JSON. Use - for stdin.")
+}
+
+func addConfigFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(configFile, "config", "",
+		fmt.Sprintf("YAML config file with the profiles, \"./%s\" or \"$XDG_CONFIG_HOME/citool/config.yaml\" if not set", citool.ConfigFilename))
+	flagSet.StringVar(profileName, "profile", "", "Profile of the config file to use, the default profile of the config file if not set")
+}
+
+func printUsage() {
+	output := flag.CommandLine.Output()
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(output, "Usage: citool <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(output, "  %-10s%s\n", cmd.name, cmd.description)
+	}
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(output, "  %-10s%s\n", "help", "Print help of a command")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(output, "\nRun \"citool help <command>\" for the flags of a command.\n")
+}
+
+func printCommandUsage(cmd command) {
+	output := cmd.flagSet.Output()
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(output, "%s\n\nUsage: %s\n", cmd.description,
+		strings.TrimSpace(fmt.Sprintf("citool %s [flags] %s", cmd.name, cmd.argsUsage)))
+	hasFlags := false
+	cmd.flagSet.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(output, "\nFlags:\n")
+		cmd.flagSet.PrintDefaults()
+	}
+	if len(cmd.examples) > 0 {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(output, "\nExamples:\n")
+		for _, example := range cmd.examples {
+			//noinspection GoUnhandledErrorResult
+			fmt.Fprintf(output, "  %s\n", example)
+		}
+	}
+}
+
+func getCommandOrExit(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command: \"%s\"\n\n", name)
+	printUsage()
+	os.Exit(1)
+	return nil
+}
+
 func main() {
-	flag.Parse()
-
-	citool.SetDebugMode(*debugMode)
-	if *version {
-		fmt.Printf("%s\n", versionString)
-		os.Exit(0)
-	} else if *mode == "analyze" {
-		analyze()
-	} else if *mode == "download" {
-		download()
-	} else {
-		flag.Usage()
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runCommand(args[0], args[1:])
+		return
+	}
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		runCommand("help", nil)
+		return
+	}
+	// Before the sub-commands, the command was selected with the --mode flag.
+	if isDeprecatedVersionFlagSet(args) {
+		runCommand("version", nil)
+		return
+	}
+	if mode, modeArgs, found := getDeprecatedModeArgs(args); found && (mode == "analyze" || mode == "download") {
+		fmt.Fprintf(os.Stderr, "Warning: --mode is deprecated, use \"citool %s\" instead\n", mode)
+		runCommand(mode, modeArgs)
+		return
+	}
+	printUsage()
+	os.Exit(1)
+}
+
+func runCommand(name string, args []string) {
+	if name == "help" {
+		flag.CommandLine.SetOutput(os.Stdout)
+		if len(args) == 0 {
+			printUsage()
+			return
+		}
+		cmd := getCommandOrExit(args[0])
+		cmd.flagSet.SetOutput(os.Stdout)
+		cmd.flagSet.Usage()
+		return
+	}
+	cmd := getCommandOrExit(name)
+	//noinspection GoUnhandledErrorResult
+	cmd.flagSet.Parse(args)
+	if len(cmd.argsUsage) == 0 && cmd.flagSet.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected arguments for %s: %s\n\n", name, strings.Join(cmd.flagSet.Args(), " "))
+		cmd.flagSet.Usage()
+		os.Exit(2)
+	}
+	if isConfigurable(cmd.flagSet) {
+		citool.ApplySettings(cmd.flagSet, getProfile(), citool.ConfigSettings...)
+	}
+	level := citool.GetLogLevelOrFail(*logLevel)
+	if *debugMode {
+		level = slog.LevelDebug
+	}
+	citool.SetLogging(level, *logFormat)
+	cmd.run(cmd.flagSet.Args())
+}
+
+func isConfigurable(flagSet *flag.FlagSet) bool {
+	for _, configurableFlagSet := range configurableFlagSets {
+		if flagSet == configurableFlagSet {
+			return true
+		}
+	}
+	return false
+}
+
+// getConfigFile returns the config file set by the flag or the environment or the default one.
+func getConfigFile() string {
+	if len(*configFile) > 0 {
+		return *configFile
+	}
+	if filename := os.Getenv(citool.GetEnvVarName("config")); len(filename) > 0 {
+		return filename
+	}
+	return citool.FindConfigFile()
+}
+
+// getProfile returns the settings of the selected profile, empty if there is no config file.
+func getProfile() map[string]string {
+	filename := getConfigFile()
+	if len(filename) == 0 {
+		return make(map[string]string)
+	}
+	name := *profileName
+	if len(name) == 0 {
+		name = os.Getenv(citool.GetEnvVarName("profile"))
+	}
+	profile := citool.GetConfig(filename).GetProfile(name)
+	citool.ValidateProfile(profile, configurableFlagSets...)
+	return profile
+}
+
+// showConfig prints the settings of every command using the config, with the secrets redacted.
+func showConfig(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		configFlags.Usage()
+		os.Exit(2)
+	}
+	// Flags after "show"
+	//noinspection GoUnhandledErrorResult
+	configFlags.Parse(args[1:])
+	if configFlags.NArg() > 0 {
+		configFlags.Usage()
+		os.Exit(2)
+	}
+	profile := getProfile()
+	filename := getConfigFile()
+	if len(filename) == 0 {
+		filename = "none"
+	}
+	fmt.Printf("Config file: %s\n\n", filename)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Command\tSetting\tValue\tSource")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "-------\t-------\t-----\t------")
+	for _, flagSet := range configurableFlagSets {
+		sources := citool.ApplySettings(flagSet, profile, citool.ConfigSettings...)
+		flagSet.VisitAll(func(f *flag.Flag) {
+			source, present := sources[f.Name]
+			if !present {
+				return
+			}
+			value := f.Value.String()
+			if citool.IsSecretSetting(f.Name) && len(value) > 0 {
+				value = "********"
+			}
+			//noinspection GoUnhandledErrorResult
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", flagSet.Name(), f.Name, value, source)
+		})
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
+
+// getDeprecatedModeArgs returns the mode and the rest of the arguments from "--mode <mode> <args>".
+func getDeprecatedModeArgs(args []string) (string, []string, bool) {
+	for i, arg := range args {
+		for _, prefix := range []string{"-mode", "--mode"} {
+			if arg == prefix && i+1 < len(args) {
+				return args[i+1], append(append([]string{}, args[:i]...), args[i+2:]...), true
+			}
+			if strings.HasPrefix(arg, prefix+"=") {
+				return strings.TrimPrefix(arg, prefix+"="), append(append([]string{}, args[:i]...), args[i+1:]...), true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+func isDeprecatedVersionFlagSet(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-version", "--version", "-version=true", "--version=true":
+			return true
+		}
+	}
+	return false
+}
+
+func validateInputFiles(args []string) {
+	if *maxListedIssues < 0 {
+		fmt.Printf("Maximum number of the listed issues cannot be negative, it is %d\n", *maxListedIssues)
+		os.Exit(2)
+	}
+	validator := citool.NewDataValidator(*maxListedIssues)
+	for _, file := range getInputFiles(args) {
+		validator.ValidateFile(file)
+	}
+	validator.PrintReport()
+	if validator.HasErrors() {
 		os.Exit(1)
 	}
 }
 
-func analyze() {
-	files := getInputFiles()
-	jobResults := getCircleCiBuildResults(&files)
+func analyze(args []string) {
+	files := getInputFiles(args)
+	analyzeParams := citool.AnalyzeParams{
+		PrintJobSuccessRate:         *printJobSuccessRate,
+		PrintJobDurationInAggregate: *printJobDuration,
+		PrintJobDurationTimeSeries:  *printJobDurationTimeSeries,
+		PrintJobSuccessTimeSeries:   *printJobSuccessTimeSeries,
+		PrintFailureBreakdown:       *printFailureBreakdown,
+		PrintJobRecovery:            *printJobRecovery,
+		FailureStatuses:             getFailureStatuses(),
+		PrintTestStats:              *printTestStats,
+		PrintFlakyTests:             *printFlakyTests,
+		PrintStepDurations:          *printStepDurations,
+		PrintPullRequests:           *printPullRequests,
+		PrintConcurrency:            *printConcurrency,
+		QuarantineFilePath:          *quarantineFile}
+	if *printDoraMetrics {
+		analyzeParams.DeployJobPattern = regexp.MustCompile(*deployJobPattern)
+	}
+	if !citool.IsEmpty(costModelFile) {
+		analyzeParams.CostModel = citool.GetCostModel(*costModelFile)
+	}
+	location, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid time zone \"%s\": %s", *timeZone, err))
+	}
+	analyzeParams.Location = location
+	if *printHeatmaps || !citool.IsEmpty(heatmapFile) {
+		analyzeParams.HeatmapParams = &citool.HeatmapParams{OutputFilePath: *heatmapFile}
+	}
+	if *printAuthorStats {
+		analyzeParams.AuthorParams = &citool.AuthorParams{
+			AuthorKey: citool.GetAuthorKeyOrFail(*authorKey),
+			Anonymize: *anonymizeAuthors}
+	}
+	if !citool.IsEmpty(failureRulesFile) {
+		// Otherwise every failure would be silently unclassified
+		if !dirExists(*failureLogsDir) {
+			fmt.Printf("Failure logs directory \"%s\" not found, -failure-rules requires -failure-logs-dir\n", *failureLogsDir)
+			os.Exit(1)
+		}
+		analyzeParams.FailureCategories = citool.GetFailureCategories(*failureRulesFile)
+		analyzeParams.FailureLogsDir = *failureLogsDir
+	}
 	filterParams := citool.FilterParams{
 		Username:       username,
 		RepositoryName: repositoryName,
 		BranchName:     branchName,
 		JobName:        jobname,
 		JobStatus:      jobStatus}
-	filterParams.FilterData(&jobResults)
-	analyzeParams := citool.AnalyzeParams{
-		PrintJobSuccessRate:         *printJobSuccessRate,
-		PrintJobDurationInAggregate: *printJobDuration,
-		PrintJobDurationTimeSeries:  *printJobDurationTimeSeries,
-		PrintJobSuccessTimeSeries:   *printJobSuccessTimeSeries}
-	citool.PrintJobStats(jobResults, analyzeParams)
+	filterParams.LogFilters()
+	var testResults citool.TestResults
+	if !citool.IsEmpty(testResultsDir) {
+		testResults = citool.GetTestResults(*testResultsDir)
+	}
+	// The results are filtered and aggregated as they are read.
+	aggregator := citool.NewJobStatsAggregator(analyzeParams)
+	for _, file := range files {
+		// Ignore empty file names
+		if len(file) == 0 {
+			continue
+		}
+		citool.ReadCircleCIJobResults(file, func(result citool.CircleCiJobResult) {
+			if !filterParams.Matches(result) {
+				return
+			}
+			result.Tests = testResults.Get(result)
+			aggregator.AddResult(result)
+		})
+	}
+	aggregator.PrintJobStats()
 }
 
-func download() {
-	var jobStatusType *citool.JobStatusFilterTypes
-	if !citool.IsEmpty(jobStatus) {
-		tmp := citool.JobStatusFilterTypes(citool.GetJobStatusFilterOrFail(*jobStatus))
-		jobStatusType = &tmp
+func download(args []string) {
+	// Never log any of the tokens
+	citool.RegisterSecret(*gitLabToken)
+	citool.RegisterSecret(*jenkinsToken)
+	citool.RegisterSecret(*buildkiteToken)
+	var report *citool.DownloadReport
+	switch *provider {
+	case "circleci":
+		report = downloadFromCircleCi()
+	case "gitlab":
+		report = downloadFromGitLab()
+	case "jenkins":
+		report = downloadFromJenkins()
+	case "buildkite":
+		report = downloadFromBuildkite()
+	default:
+		fmt.Printf("Unsupported provider: \"%s\"\n", *provider)
+		os.Exit(1)
 	}
-	downloadParams := citool.DownloadParams{
-		CircleToken:     circleCiToken,
-		VcsType:         vcsType,
+	report.Print()
+	if report.HasFailures() {
+		os.Exit(1)
+	}
+}
+
+func downloadFromGitLab() *citool.DownloadReport {
+	downloadParams := citool.GitLabDownloadParams{
+		BaseURL:         gitLabURL,
+		PrivateToken:    gitLabToken,
 		Username:        username,
 		RepositoryName:  repositoryName,
 		BranchName:      branchName,
 		Start:           *downloadStartOffset,
 		Limit:           *downloadLimit,
 		DownloadDirPath: *downloadDirPath,
-		JobStatus:       jobStatusType}
-	citool.DownloadCircleCIJobResults(downloadParams)
+		Compression:     citool.GetCompressionOrFail(*downloadCompression),
+		OutputTemplate:  *outputTemplate}
+	return citool.DownloadGitLabJobResults(downloadParams)
 }
 
-func getInputFiles() []string {
-	files := make([]string, 0)
+func downloadFromJenkins() *citool.DownloadReport {
+	downloadParams := citool.JenkinsDownloadParams{
+		BaseURL:         jenkinsURL,
+		User:            jenkinsUser,
+		APIToken:        jenkinsToken,
+		JobName:         jenkinsJob,
+		Start:           *downloadStartOffset,
+		Limit:           *downloadLimit,
+		DownloadDirPath: *downloadDirPath,
+		Compression:     citool.GetCompressionOrFail(*downloadCompression),
+		OutputTemplate:  *outputTemplate}
+	return citool.DownloadJenkinsJobResults(downloadParams)
+}
+
+func downloadFromBuildkite() *citool.DownloadReport {
+	downloadParams := citool.BuildkiteDownloadParams{
+		BaseURL:          buildkiteURL,
+		AccessToken:      buildkiteToken,
+		OrganizationSlug: username,
+		PipelineSlug:     repositoryName,
+		BranchName:       branchName,
+		Start:            *downloadStartOffset,
+		Limit:            *downloadLimit,
+		DownloadDirPath:  *downloadDirPath,
+		Compression:      citool.GetCompressionOrFail(*downloadCompression),
+		OutputTemplate:   *outputTemplate}
+	return citool.DownloadBuildkiteJobResults(downloadParams)
+}
+
+func downloadFromCircleCi() *citool.DownloadReport {
+	var jobStatusType *citool.JobStatusFilterTypes
+	if !citool.IsEmpty(jobStatus) {
+		tmp := citool.JobStatusFilterTypes(citool.GetJobStatusFilterOrFail(*jobStatus))
+		jobStatusType = &tmp
+	}
+	circleToken := citool.GetToken(*circleCiToken, *circleCiTokenFile, *circleCiTokenCommand)
+	downloadParams := citool.DownloadParams{
+		BaseURL:              circleCiURL,
+		CircleToken:          &circleToken,
+		VcsType:              vcsType,
+		Username:             username,
+		RepositoryName:       repositoryName,
+		BranchName:           branchName,
+		Start:                *downloadStartOffset,
+		Limit:                *downloadLimit,
+		DownloadDirPath:      *downloadDirPath,
+		JobStatus:            jobStatusType,
+		Compression:          citool.GetCompressionOrFail(*downloadCompression),
+		OutputTemplate:       *outputTemplate,
+		DownloadTests:        *downloadTests,
+		Deep:                 *deepDownload,
+		DownloadBuildDetails: *downloadBuildDetails,
+		DownloadFailureLogs:  *downloadFailureLogs}
+	return citool.DownloadCircleCIJobResults(downloadParams)
+}
+
+func getFailureStatuses() []citool.JobStatusType {
+	statuses := make([]citool.JobStatusType, 0)
+	for _, status := range strings.Split(*failureStatuses, ",") {
+		status = strings.TrimSpace(status)
+		if len(status) == 0 {
+			continue
+		}
+		jobStatus := citool.GetJobStatusOrFail(status)
+		if jobStatus.IsSuccess() {
+			fmt.Printf("Job status \"%s\" cannot count against the success rate\n", status)
+			os.Exit(1)
+		}
+		statuses = append(statuses, jobStatus)
+	}
+	return statuses
+}
+
+func getInputFiles(args []string) []string {
+	paths := make([]string, 0)
 	if len(*inputFiles) > 0 {
-		files = append(files, strings.Split(*inputFiles, ",")...)
+		paths = append(paths, strings.Split(*inputFiles, ",")...)
 	}
-	if len(flag.Args()) > 0 {
+	if len(args) > 0 {
 		// Treat non-positional args as input files as well
-		files = append(files, flag.Args()...)
+		paths = append(paths, args...)
 	}
 	// Get default files
-	if len(files) == 0 && dirExists(defaultDownloadDir) {
-		fileInfos, err := os.ReadDir(defaultDownloadDir)
-		if err != nil {
-			panic(err)
-		}
-		for _, fileInfo := range fileInfos {
-			if !fileInfo.IsDir() && strings.HasSuffix(fileInfo.Name(), ".json") {
-				filePath := filepath.Join(defaultDownloadDir, fileInfo.Name())
-				citool.LogDebug(fmt.Sprintf("Found default file: %s", filePath))
-				files = append(files, filePath)
-			}
-		}
+	if len(paths) == 0 && dirExists(defaultDownloadDir) {
+		paths = append(paths, defaultDownloadDir)
 	}
-	citool.LogDebug(fmt.Sprintf("Files are %d\n", len(files)))
+	files := citool.ExpandInputPaths(paths)
+	citool.LogDebug("Found input files", "files", len(files))
 
 	if len(files) == 0 {
 		fmt.Printf("No input files provided\n")
@@ -180,19 +789,3 @@ func dirExists(dirname string) bool {
 	}
 	return fileInfo.IsDir()
 }
-
-func getCircleCiBuildResults(files *[]string) []citool.CircleCiJobResult {
-	data := make([]citool.CircleCiJobResult, 0)
-	for _, file := range *files {
-		citool.LogDebug(fmt.Sprintf("Input file: \"%s\"", file))
-		// Ignore empty file names
-		if len(file) == 0 {
-			continue
-		}
-		tmp := citool.GetCircleCIJobResults(file)
-		data = append(data, tmp...)
-	}
-	// To add an empty line after debug logging.
-	citool.LogDebug("")
-	return data
-}
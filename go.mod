@@ -1,8 +1,10 @@
 module github.com/ashishb/ci-analysis-tool
 
-go 1.20
+go 1.21
 
 require (
 	github.com/guptarohit/asciigraph v0.4.2-0.20190112130928-1bc9b2452856
+	github.com/klauspost/compress v1.17.11
+	gopkg.in/yaml.v3 v3.0.1
 	robpike.io/filter v0.0.0-20150108201509-2984852a2183
 )
@@ -1,10 +1,14 @@
 package citool
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"github.com/guptarohit/asciigraph"
+	"io"
+	"math"
 	"os"
+	"regexp"
 	"sort"
 	"text/tabwriter"
 	"time"
@@ -12,33 +16,162 @@ import (
 
 // CircleCiJobWorkflow encapsulates the relevant portions of "workflows" filed in a Circle CI build result.
 type CircleCiJobWorkflow struct {
-	JobName string `json:"job_name"`
+	JobName      string `json:"job_name"`
+	WorkflowID   string `json:"workflow_id"`
+	WorkflowName string `json:"workflow_name"`
+}
+
+// CircleCiUser encapsulates the relevant portions of the user who triggered a Circle CI build.
+type CircleCiUser struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+// CircleCiResourceClass encapsulates the relevant portions of the resource class of a Circle CI build.
+type CircleCiResourceClass struct {
+	Class string `json:"class"`
+}
+
+// CircleCiExecutor encapsulates the relevant portions of "picard" field in a Circle CI build result.
+// Only available in the full build results.
+type CircleCiExecutor struct {
+	ResourceClass CircleCiResourceClass `json:"resource_class"`
+}
+
+// CircleCiStepAction encapsulates the relevant portions of an action of a build step.
+// A step has one action per parallel container.
+type CircleCiStepAction struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	Failed        bool   `json:"failed"`
+	RunTimeMillis int64  `json:"run_time_millis"`
+	OutputURL     string `json:"output_url"`
+}
+
+// CircleCiJobStep encapsulates the relevant portions of a step in the full Circle CI build result.
+type CircleCiJobStep struct {
+	Name    string               `json:"name"`
+	Actions []CircleCiStepAction `json:"actions"`
 }
 
 // CircleCiJobResult encapsulates the relevant portions of a single Circle CI build result.
 type CircleCiJobResult struct {
-	Username    string              `json:"username"`
-	Reponame    string              `json:"reponame"`
-	Branch      string              `json:"branch"`
-	BuildNumber int                 `json:"build_num"`
-	Status      JobStatusType       `json:"status"`
-	EndTime     string              `json:"stop_time"`
-	StartTime   string              `json:"start_time"`
-	Workflows   CircleCiJobWorkflow `json:"workflows"`
+	Username       string                `json:"username"`
+	Reponame       string                `json:"reponame"`
+	Branch         string                `json:"branch"`
+	BuildNumber    int                   `json:"build_num"`
+	BuildURL       string                `json:"build_url"`
+	VcsRevision    string                `json:"vcs_revision"`
+	CommitterDate  string                `json:"committer_date"`
+	CommitterEmail string                `json:"committer_email"`
+	AuthorName     string                `json:"author_name"`
+	Status         JobStatusType         `json:"status"`
+	EndTime        string                `json:"stop_time"`
+	StartTime      string                `json:"start_time"`
+	QueuedTime     string                `json:"usage_queued_at"`
+	Workflows      CircleCiJobWorkflow   `json:"workflows"`
+	User           CircleCiUser          `json:"user"`
+	Platform       string                `json:"platform"`
+	Parallel       int                   `json:"parallel"`
+	Picard         CircleCiExecutor      `json:"picard"`
+	PullRequests   []CircleCiPullRequest `json:"pull_requests"`
+	// Not part of the Circle CI build result, set by the providers running several jobs in a build,
+	// like Buildkite, to tell apart the jobs with the same build number.
+	JobID string `json:"job_id,omitempty"`
+	// Build number of the original build if this is a rerun.
+	RetryOf *int   `json:"retry_of"`
+	Why     string `json:"why"`
+	// Only available in the build details, see DownloadParams.DownloadBuildDetails.
+	Steps []CircleCiJobStep `json:"steps"`
+	// Not part of the Circle CI build result, see GetTestResults.
+	Tests []TestCaseResult `json:"-"`
+}
+
+func (result CircleCiJobResult) isRerun() bool {
+	return result.RetryOf != nil || result.Why == "retry"
 }
 
 // GetCircleCIJobResults reads filename and returns the results as an array of Circle CI build results.
+//
+// Deprecated: All the results of the file are in memory at once, use ReadCircleCIJobResults.
 func GetCircleCIJobResults(filename string) []CircleCiJobResult {
-	contents, err := os.ReadFile(filename)
-	if err != nil {
-		panic(fmt.Sprintf("Unable to read file \"%s\"", filename))
+	circleCiBuildResults := make([]CircleCiJobResult, 0)
+	ReadCircleCIJobResults(filename, func(result CircleCiJobResult) {
+		circleCiBuildResults = append(circleCiBuildResults, result)
+	})
+	return circleCiBuildResults
+}
+
+// ReadCircleCIJobResults decodes the results in filename one at a time and calls callback for
+// every result, so that the whole file is never in memory.
+// The results are either a JSON array, like the downloaded pages, or newline-delimited JSON
+// with one result per line. Compressed files and tar archives are read as well, see readInputFile.
+func ReadCircleCIJobResults(filename string, callback func(result CircleCiJobResult)) {
+	readInputFile(filename, func(name string, reader io.Reader) {
+		readJobResults(name, reader, callback)
+	})
+}
+
+func readJobResults(name string, reader io.Reader, callback func(result CircleCiJobResult)) {
+	bufferedReader := bufio.NewReader(reader)
+	isArray := false
+	firstByte, _, err := skipWhitespace(bufferedReader)
+	if err == nil {
+		isArray = firstByte == '['
+	} else if err != io.EOF {
+		panic(fmt.Sprintf("Unable to read file \"%s\"", name))
 	}
-	var circleCiBuildResults []CircleCiJobResult
-	err2 := json.Unmarshal(contents, &circleCiBuildResults)
-	if err2 != nil {
-		panic("Failed to extract JSON" + err2.Error())
+	decoder := json.NewDecoder(bufferedReader)
+	resultCount := 0
+	decodeResults := func() {
+		for decoder.More() {
+			var result CircleCiJobResult
+			err2 := decoder.Decode(&result)
+			if err2 != nil {
+				panic("Failed to extract JSON" + err2.Error())
+			}
+			resultCount++
+			callback(result)
+		}
+	}
+	if !isArray {
+		decodeResults()
+		LogDebug("Read job results", "file", name, "results", resultCount, "ndjson", true)
+		return
+	}
+	// Concatenated arrays, like "cat *.json", are read one after another
+	for decoder.More() {
+		token, err3 := decoder.Token()
+		if err3 != nil {
+			panic("Failed to extract JSON" + err3.Error())
+		}
+		if token != json.Delim('[') {
+			panic(fmt.Sprintf("Failed to extract JSON from %s: expected an array of job results", name))
+		}
+		decodeResults()
+		_, err4 := decoder.Token()
+		if err4 != nil {
+			panic("Failed to extract JSON" + err4.Error())
+		}
+	}
+	LogDebug("Read job results", "file", name, "results", resultCount)
+}
+
+// skipWhitespace returns the first non-whitespace byte without consuming it and the number of
+// the newlines skipped.
+func skipWhitespace(reader *bufio.Reader) (byte, int, error) {
+	newlineCount := 0
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, newlineCount, err
+		}
+		if b == '\n' {
+			newlineCount++
+		} else if b != ' ' && b != '\t' && b != '\r' {
+			return b, newlineCount, reader.UnreadByte()
+		}
 	}
-	return circleCiBuildResults
 }
 
 // AggregateJobInfo is aggregated job status information from the individual jobs
@@ -48,6 +181,8 @@ type AggregateJobInfo struct {
 	CumulativeDuration time.Duration
 	SuccessCount       int32
 	FailureCount       int32
+	// Number of jobs with each status, unlike the other fields all the statuses are counted.
+	StatusCounts map[JobStatusType]int
 }
 
 // AnalyzeParams are used for configuring the analysis mode settings.
@@ -56,40 +191,204 @@ type AnalyzeParams struct {
 	PrintJobDurationInAggregate bool
 	PrintJobDurationTimeSeries  bool
 	PrintJobSuccessTimeSeries   bool
+	PrintFailureBreakdown       bool
+	PrintJobRecovery            bool
+	PrintTestStats              bool
+	PrintFlakyTests             bool
+	PrintStepDurations          bool
+	PrintPullRequests           bool
+	PrintConcurrency            bool
+	// Statuses which count against the success rate, JobStatusFailed if empty.
+	FailureStatuses []JobStatusType
+	// If non-empty, the flaky tests are written to this file, one test per line.
+	QuarantineFilePath string
+	// If non-empty, failed jobs are categorised using these categories and the logs in FailureLogsDir.
+	FailureCategories []FailureCategory
+	FailureLogsDir    string
+	// If non-nil, DORA metrics are printed using the jobs matching it as the deployments.
+	DeployJobPattern *regexp.Regexp
+	// If non-nil, estimated cost is printed using it.
+	CostModel *CostModel
+	// If non-nil, per-author statistics are printed using it.
+	AuthorParams *AuthorParams
+	// If non-nil, weekday x hour heatmaps are printed using it.
+	HeatmapParams *HeatmapParams
+	// Time zone used for the heatmaps and the daily concurrency, UTC if nil.
+	Location *time.Location
 }
 
 // PrintJobStats prints the aggregated job statistics from results.
+//
+// Deprecated: All the results are in memory at once, add them to a JobStatsAggregator as they are read.
 func PrintJobStats(results []CircleCiJobResult, params AnalyzeParams) {
-	fmt.Printf("Number of job results: %d\n", len(results))
-	aggregateJobInfo := make(map[string]*AggregateJobInfo, 0)
+	aggregator := NewJobStatsAggregator(params)
 	for _, result := range results {
-		jobName := result.Workflows.JobName
-		status := result.Status
-		// Only filter on success/failure for now
-		if status != "success" && status != "failed" {
-			continue
-		}
-		duration := getJobDuration(result)
-		existingAggregateJobInfo, present := aggregateJobInfo[jobName]
-		if !present {
-			existingAggregateJobInfo = &AggregateJobInfo{jobName, 0, time.Duration(0), 0, 0}
-		}
-		existingAggregateJobInfo.Frequency++
-		existingAggregateJobInfo.CumulativeDuration += duration
-		aggregateJobInfo[jobName] = existingAggregateJobInfo
-		aggregateJobInfo[jobName].Frequency = aggregateJobInfo[jobName].Frequency + 1
-		if status == JobStatusSuccess {
-			existingAggregateJobInfo.SuccessCount++
-		} else if status == JobStatusFailed {
-			existingAggregateJobInfo.FailureCount++
-		} else {
-			panic("Unexpected status: " + status)
-		}
+		aggregator.AddResult(result)
 	}
+	aggregator.PrintJobStats()
+}
 
-	values := make([]*AggregateJobInfo, 0, len(aggregateJobInfo))
-	for _, v := range aggregateJobInfo {
-		values = append(values, v)
+// JobStatsAggregator aggregates the job results one at a time, so that the full results, with their
+// steps and test results, don't need to be in memory all at once. The memory used still grows with
+// the number of the results for some of the reports: the graphs and the heatmaps keep a time or a duration
+// per job, the step and test reports keep a duration per step and test run, and the reports which walk
+// the history keep a compact copy of every result, see needsResultHistory. The rest of the reports only
+// keep the aggregates per job, author or revision.
+type JobStatsAggregator struct {
+	params           AnalyzeParams
+	failureStatuses  []JobStatusType
+	location         *time.Location
+	resultCount      int
+	aggregateJobInfo map[string]*AggregateJobInfo
+	jobDurations     map[string][]startTimeAndDurationPair
+	jobStatuses      map[string][]startTimeAndJobStatusPair
+	costs            *costAggregator
+	authorStats      *authorStatsAggregator
+	heatmap          *heatmapAggregator
+	testStats        *testStatsAggregator
+	stepDurations    *stepDurationAggregator
+	results          []CircleCiJobResult
+}
+
+// NewJobStatsAggregator creates an aggregator for the reports enabled in params.
+func NewJobStatsAggregator(params AnalyzeParams) *JobStatsAggregator {
+	failureStatuses := params.FailureStatuses
+	if len(failureStatuses) == 0 {
+		failureStatuses = []JobStatusType{JobStatusFailed}
+	}
+	location := params.Location
+	if location == nil {
+		location = time.UTC
+	}
+	aggregator := &JobStatsAggregator{
+		params:           params,
+		failureStatuses:  failureStatuses,
+		location:         location,
+		aggregateJobInfo: make(map[string]*AggregateJobInfo),
+		jobDurations:     make(map[string][]startTimeAndDurationPair),
+		jobStatuses:      make(map[string][]startTimeAndJobStatusPair),
+		results:          make([]CircleCiJobResult, 0)}
+	if params.CostModel != nil {
+		aggregator.costs = newCostAggregator(*params.CostModel, failureStatuses)
+	}
+	if params.AuthorParams != nil {
+		aggregator.authorStats = newAuthorStatsAggregator(*params.AuthorParams, params.CostModel, failureStatuses)
+	}
+	if params.HeatmapParams != nil {
+		aggregator.heatmap = newHeatmapAggregator(*params.HeatmapParams, location, failureStatuses)
+	}
+	if params.PrintTestStats || params.PrintFlakyTests || len(params.QuarantineFilePath) > 0 {
+		aggregator.testStats = newTestStatsAggregator()
+	}
+	if params.PrintStepDurations {
+		aggregator.stepDurations = newStepDurationAggregator()
+	}
+	return aggregator
+}
+
+// needsResultHistory returns true if any of the enabled reports walks the history of the jobs,
+// like the failure streaks of the recovery report.
+func (params AnalyzeParams) needsResultHistory() bool {
+	return params.PrintJobRecovery || params.PrintPullRequests || params.PrintConcurrency ||
+		len(params.FailureCategories) > 0 || params.DeployJobPattern != nil
+}
+
+// getHistoryEntry returns the fields of the result used by the reports walking the history,
+// without the steps and the test results.
+func (result CircleCiJobResult) getHistoryEntry() CircleCiJobResult {
+	return CircleCiJobResult{
+		Username:      result.Username,
+		Reponame:      result.Reponame,
+		Branch:        result.Branch,
+		BuildNumber:   result.BuildNumber,
+		JobID:         result.JobID,
+		BuildURL:      result.BuildURL,
+		VcsRevision:   result.VcsRevision,
+		CommitterDate: result.CommitterDate,
+		Status:        result.Status,
+		EndTime:       result.EndTime,
+		StartTime:     result.StartTime,
+		QueuedTime:    result.QueuedTime,
+		Workflows:     result.Workflows,
+		Platform:      result.Platform,
+		Parallel:      result.Parallel,
+		Picard:        result.Picard,
+		PullRequests:  result.PullRequests}
+}
+
+// AddResult adds a job result to the aggregates.
+func (aggregator *JobStatsAggregator) AddResult(result CircleCiJobResult) {
+	aggregator.resultCount++
+	if aggregator.params.needsResultHistory() {
+		aggregator.results = append(aggregator.results, result.getHistoryEntry())
+	}
+	if aggregator.params.PrintJobDurationTimeSeries {
+		addTimeSeriesDuration(aggregator.jobDurations, result)
+	}
+	if aggregator.params.PrintJobSuccessTimeSeries {
+		addTimeSeriesSuccess(aggregator.jobStatuses, result)
+	}
+	if aggregator.costs != nil {
+		aggregator.costs.addResult(result)
+	}
+	if aggregator.authorStats != nil {
+		aggregator.authorStats.addResult(result)
+	}
+	if aggregator.heatmap != nil {
+		aggregator.heatmap.addResult(result)
+	}
+	if aggregator.testStats != nil {
+		aggregator.testStats.addResult(result)
+	}
+	if aggregator.stepDurations != nil {
+		aggregator.stepDurations.addResult(result)
+	}
+	jobName := result.Workflows.JobName
+	status := result.Status
+	existingAggregateJobInfo, present := aggregator.aggregateJobInfo[jobName]
+	if !present {
+		existingAggregateJobInfo = &AggregateJobInfo{
+			JobName:      jobName,
+			StatusCounts: make(map[JobStatusType]int)}
+		aggregator.aggregateJobInfo[jobName] = existingAggregateJobInfo
+	}
+	existingAggregateJobInfo.StatusCounts[status]++
+	// Only the successful jobs and the jobs with one of the failure statuses count towards
+	// the success rate and the duration.
+	isSuccess := status.IsSuccess()
+	isFailure := containsJobStatus(aggregator.failureStatuses, status)
+	if !isSuccess && !isFailure {
+		return
+	}
+	// Jobs which failed before starting, for example, due to infrastructure failure,
+	// don't have a duration.
+	if len(result.StartTime) > 0 && len(result.EndTime) > 0 {
+		existingAggregateJobInfo.CumulativeDuration += getJobDuration(result)
+	}
+	existingAggregateJobInfo.Frequency++
+	aggregator.aggregateJobInfo[jobName].Frequency = aggregator.aggregateJobInfo[jobName].Frequency + 1
+	if isSuccess {
+		existingAggregateJobInfo.SuccessCount++
+	} else {
+		existingAggregateJobInfo.FailureCount++
+	}
+}
+
+// PrintJobStats prints the enabled reports of the results added so far.
+func (aggregator *JobStatsAggregator) PrintJobStats() {
+	params := aggregator.params
+	failureStatuses := aggregator.failureStatuses
+	results := aggregator.results
+	fmt.Printf("Number of job results: %d\n", aggregator.resultCount)
+
+	// Jobs which never succeeded or failed are only relevant for the status breakdown.
+	values := make([]*AggregateJobInfo, 0, len(aggregator.aggregateJobInfo))
+	allValues := make([]*AggregateJobInfo, 0, len(aggregator.aggregateJobInfo))
+	for _, v := range aggregator.aggregateJobInfo {
+		if v.Frequency > 0 {
+			values = append(values, v)
+		}
+		allValues = append(allValues, v)
 	}
 
 	if params.PrintJobSuccessRate {
@@ -100,11 +399,59 @@ func PrintJobStats(results []CircleCiJobResult, params AnalyzeParams) {
 		printJobDuration(values)
 		fmt.Println("")
 	}
+	if params.PrintFailureBreakdown {
+		printFailureBreakdown(allValues)
+		fmt.Println("")
+	}
+	if params.PrintJobRecovery {
+		printJobRecovery(results, failureStatuses)
+		fmt.Println("")
+	}
+	if params.DeployJobPattern != nil {
+		printDoraMetrics(results, params.DeployJobPattern, failureStatuses)
+		fmt.Println("")
+	}
+	if aggregator.costs != nil {
+		aggregator.costs.print()
+		fmt.Println("")
+	}
+	if aggregator.authorStats != nil {
+		aggregator.authorStats.print()
+		fmt.Println("")
+	}
+	if params.PrintPullRequests {
+		printPullRequestStats(results, params.CostModel)
+		fmt.Println("")
+	}
+	if aggregator.heatmap != nil {
+		aggregator.heatmap.print()
+	}
+	if params.PrintConcurrency {
+		printConcurrency(results, aggregator.location)
+	}
 	if params.PrintJobDurationTimeSeries {
-		printTimeSeriesDurationData(results)
+		printTimeSeriesDurationData(aggregator.jobDurations)
 	}
 	if params.PrintJobSuccessTimeSeries {
-		printTimeSeriesSuccessData(results)
+		printTimeSeriesSuccessData(aggregator.jobStatuses)
+	}
+	if params.PrintTestStats {
+		printTestStats(aggregator.testStats.getAggregateTestInfo())
+	}
+	if aggregator.stepDurations != nil {
+		aggregator.stepDurations.print()
+	}
+	if len(params.FailureCategories) > 0 {
+		printFailureCategories(results, aggregator.failureStatuses, params.FailureCategories, params.FailureLogsDir)
+	}
+	if params.PrintFlakyTests || len(params.QuarantineFilePath) > 0 {
+		flakyTests := getFlakyTests(aggregator.testStats.getAggregateTestInfo())
+		if params.PrintFlakyTests {
+			printFlakyTests(flakyTests)
+		}
+		if len(params.QuarantineFilePath) > 0 {
+			writeQuarantineFile(params.QuarantineFilePath, flakyTests)
+		}
 	}
 }
 
@@ -165,6 +512,63 @@ func printJobSuccessRate(aggregateJobInfo []*AggregateJobInfo) {
 	writer.Flush()
 }
 
+// Statuses which are neither a success nor one of the known failure kinds are reported as "Other".
+var successStatuses = []JobStatusType{JobStatusSuccess, JobStatusFixed}
+var codeFailureStatuses = []JobStatusType{JobStatusFailed, JobStatusNoTests}
+var infraFailureStatuses = []JobStatusType{JobStatusInfrastructureFail}
+var timeoutStatuses = []JobStatusType{JobStatusTimedOut}
+var cancellationStatuses = []JobStatusType{JobStatusCanceled}
+
+func (info AggregateJobInfo) countStatuses(statuses []JobStatusType) int {
+	count := 0
+	for _, status := range statuses {
+		count += info.StatusCounts[status]
+	}
+	return count
+}
+
+func (info AggregateJobInfo) countAllStatuses() int {
+	count := 0
+	for _, v := range info.StatusCounts {
+		count += v
+	}
+	return count
+}
+
+func printFailureBreakdown(aggregateJobInfo []*AggregateJobInfo) {
+	sort.Slice(aggregateJobInfo, func(i, j int) bool {
+		// Highest number of unsuccessful jobs first
+		unsuccessfulCount1 := aggregateJobInfo[i].countAllStatuses() - aggregateJobInfo[i].countStatuses(successStatuses)
+		unsuccessfulCount2 := aggregateJobInfo[j].countAllStatuses() - aggregateJobInfo[j].countStatuses(successStatuses)
+		if unsuccessfulCount1 != unsuccessfulCount2 {
+			return unsuccessfulCount1 > unsuccessfulCount2
+		}
+		// Sort on the basis of name to have stable outcome
+		return aggregateJobInfo[i].JobName < aggregateJobInfo[j].JobName
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Job name\tTotal\tSuccess\tCode failures\tInfra failures\tTimeouts\tCancellations\tOther")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "--------\t-----\t-------\t-------------\t--------------\t--------\t-------------\t-----")
+	for _, v := range aggregateJobInfo {
+		total := v.countAllStatuses()
+		successCount := v.countStatuses(successStatuses)
+		codeFailureCount := v.countStatuses(codeFailureStatuses)
+		infraFailureCount := v.countStatuses(infraFailureStatuses)
+		timeoutCount := v.countStatuses(timeoutStatuses)
+		cancellationCount := v.countStatuses(cancellationStatuses)
+		otherCount := total - successCount - codeFailureCount - infraFailureCount - timeoutCount - cancellationCount
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			v.JobName, total, successCount, codeFailureCount, infraFailureCount,
+			timeoutCount, cancellationCount, otherCount)
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
+
 type startTimeAndDurationPair struct {
 	StartTime time.Time     // in what units?
 	Duration  time.Duration // in nanoseconds
@@ -174,23 +578,23 @@ const avgRate = 10
 const maxGraphHeight = 20 // lines
 const maxGraphWidth = 100 // characters
 
-func printTimeSeriesDurationData(results []CircleCiJobResult) {
-	fmt.Printf("Printing job duration graphs\n")
-	jobDurationsInSeconds := make(map[string][]startTimeAndDurationPair, 0)
-	for _, result := range results {
-		// Only consider successful jobs to avoid skew due to failed job which might fail early on.
-		if result.Status != JobStatusSuccess {
-			continue
-		}
-		jobName := result.Workflows.JobName
-		startTime := result.StartTime
-		duration := getJobDuration(result)
-		startTimeAndDurationPair := startTimeAndDurationPair{
-			StartTime: getTime(startTime),
-			Duration:  duration}
-		jobDurationsInSeconds[jobName] = append(
-			jobDurationsInSeconds[jobName], startTimeAndDurationPair)
+func addTimeSeriesDuration(jobDurationsInSeconds map[string][]startTimeAndDurationPair, result CircleCiJobResult) {
+	// Only consider successful jobs to avoid skew due to failed job which might fail early on.
+	if result.Status != JobStatusSuccess {
+		return
 	}
+	jobName := result.Workflows.JobName
+	startTime := result.StartTime
+	duration := getJobDuration(result)
+	startTimeAndDurationPair := startTimeAndDurationPair{
+		StartTime: getTime(startTime),
+		Duration:  duration}
+	jobDurationsInSeconds[jobName] = append(
+		jobDurationsInSeconds[jobName], startTimeAndDurationPair)
+}
+
+func printTimeSeriesDurationData(jobDurationsInSeconds map[string][]startTimeAndDurationPair) {
+	fmt.Printf("Printing job duration graphs\n")
 	for key, value := range jobDurationsInSeconds {
 		// Sort
 		sort.Slice(value, func(i, j int) bool {
@@ -219,23 +623,23 @@ type startTimeAndJobStatusPair struct {
 	JobStatus JobStatusType
 }
 
-func printTimeSeriesSuccessData(results []CircleCiJobResult) {
-	fmt.Printf("Printing job success graphs\n")
-	jobSucess := make(map[string][]startTimeAndJobStatusPair, 0)
-	for _, result := range results {
-		// Only consider successful and failed jobs to avoid skew due to failed job which might fail early on.
-		if result.Status != JobStatusSuccess && result.Status != JobStatusFailed {
-			continue
-		}
-		jobName := result.Workflows.JobName
-		jobStatus := result.Status
-		startTime := result.StartTime
-		startTimeAndJobStatusPair := startTimeAndJobStatusPair{
-			StartTime: getTime(startTime),
-			JobStatus: jobStatus}
-		jobSucess[jobName] = append(
-			jobSucess[jobName], startTimeAndJobStatusPair)
+func addTimeSeriesSuccess(jobSucess map[string][]startTimeAndJobStatusPair, result CircleCiJobResult) {
+	// Only consider successful and failed jobs to avoid skew due to failed job which might fail early on.
+	if result.Status != JobStatusSuccess && result.Status != JobStatusFailed {
+		return
 	}
+	jobName := result.Workflows.JobName
+	jobStatus := result.Status
+	startTime := result.StartTime
+	startTimeAndJobStatusPair := startTimeAndJobStatusPair{
+		StartTime: getTime(startTime),
+		JobStatus: jobStatus}
+	jobSucess[jobName] = append(
+		jobSucess[jobName], startTimeAndJobStatusPair)
+}
+
+func printTimeSeriesSuccessData(jobSucess map[string][]startTimeAndJobStatusPair) {
+	fmt.Printf("Printing job success graphs\n")
 	for key, value := range jobSucess {
 		// Sort
 		sort.Slice(value, func(i, j int) bool {
@@ -282,11 +686,11 @@ func getMovingAverage(source []float64, numPoints int) []float64 {
 	if sourceNumOfPoints < numPoints {
 		panic(fmt.Sprintf("This method should not have been called since we have less than %d points", numPoints))
 	}
-	LogDebug(fmt.Sprintf("Size: %d", sourceNumOfPoints-(numPoints-1)))
+	LogDebug("Moving average", "size", sourceNumOfPoints-(numPoints-1))
 	target := make([]float64, sourceNumOfPoints-(numPoints-1))
 	for i := range target {
 		target[i] = sum(source[i:i+numPoints]) / float64(numPoints)
-		LogDebug(fmt.Sprintf("Average from %d to %d: %f", i, i+numPoints, target[i]))
+		LogDebug("Moving average", "from", i, "to", i+numPoints, "average", target[i])
 	}
 	return target
 }
@@ -299,8 +703,20 @@ func sum(arr []float64) float64 {
 	return result
 }
 
+// getPercentile returns the percentile using the nearest-rank method, sortedValues must be sorted.
+func getPercentile(sortedValues []float64, percentile float64) float64 {
+	if len(sortedValues) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(percentile / 100 * float64(len(sortedValues))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sortedValues[rank-1]
+}
+
 func printGraph(values []float64, graphWidth int, graphHeight int) {
-	LogDebug(fmt.Sprintf("Print graph(height=%d, width=%d), %d values\n", graphHeight, graphWidth, len(values)))
+	LogDebug("Print graph", "height", graphHeight, "width", graphWidth, "values", len(values))
 	graph := asciigraph.Plot(values,
 		asciigraph.Height(graphHeight),
 		asciigraph.Width(graphWidth))
@@ -0,0 +1,239 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// AuthorKeyType is the field used for identifying the author of a job.
+type AuthorKeyType string
+
+// Values of the author key.
+const (
+	AuthorKeyLogin     AuthorKeyType = "login"     // login of the user who triggered the build
+	AuthorKeyAuthor    AuthorKeyType = "author"    // name of the commit author
+	AuthorKeyCommitter AuthorKeyType = "committer" // email of the committer
+)
+
+// GetAuthorKeyOrFail converts the string value to enum type.
+// Panics if the string value does not match any enum value.
+func GetAuthorKeyOrFail(key string) AuthorKeyType {
+	switch key {
+	case string(AuthorKeyLogin):
+		return AuthorKeyLogin
+	case string(AuthorKeyAuthor):
+		return AuthorKeyAuthor
+	case string(AuthorKeyCommitter):
+		return AuthorKeyCommitter
+	default:
+		panic("Unexpected author key value: " + key)
+	}
+}
+
+func (result CircleCiJobResult) getAuthor(authorKey AuthorKeyType) string {
+	switch authorKey {
+	case AuthorKeyAuthor:
+		return result.AuthorName
+	case AuthorKeyCommitter:
+		return result.CommitterEmail
+	default:
+		return result.User.Login
+	}
+}
+
+// AuthorParams are used for configuring the per-author report.
+type AuthorParams struct {
+	AuthorKey AuthorKeyType
+	// Replace the author names with "author-1", "author-2" etc. for sharing the report.
+	Anonymize bool
+}
+
+type aggregateAuthorInfo struct {
+	Author       string
+	JobCount     int
+	SuccessCount int
+	FailureCount int
+	// Time from the start of the first job to the end of the last job of the revisions which
+	// eventually passed, in seconds.
+	TimesToGreen []float64
+	Duration     time.Duration
+	Cost         float64
+}
+
+func (info aggregateAuthorInfo) failureRate() int {
+	if info.SuccessCount+info.FailureCount == 0 {
+		return 0
+	}
+	return 100 * info.FailureCount / (info.SuccessCount + info.FailureCount)
+}
+
+func (info aggregateAuthorInfo) averageTimeToGreen() time.Duration {
+	if len(info.TimesToGreen) == 0 {
+		return 0
+	}
+	return time.Duration(sum(info.TimesToGreen) / float64(len(info.TimesToGreen)) * float64(time.Second))
+}
+
+// revisionRuns is what is needed from the jobs of a VCS revision for the time to green,
+// the jobs are added one at a time.
+type revisionRuns struct {
+	Author         string
+	FirstStartTime time.Time
+	LastEndTime    time.Time
+	// Start time and status of the latest run of every job.
+	LatestJobRuns map[string]startTimeAndJobStatusPair
+}
+
+func newRevisionRuns(author string) *revisionRuns {
+	return &revisionRuns{Author: author, LatestJobRuns: make(map[string]startTimeAndJobStatusPair)}
+}
+
+// getTimeToGreen returns the time from the start of the first job to the end of the last job
+// of a revision, if the latest run of every job of the revision succeeded.
+func getTimeToGreen(revisionResults []CircleCiJobResult) (time.Duration, bool) {
+	runs := newRevisionRuns("")
+	for _, result := range revisionResults {
+		runs.addResult(result)
+	}
+	return runs.getTimeToGreen()
+}
+
+func (runs *revisionRuns) addResult(result CircleCiJobResult) {
+	if len(result.StartTime) == 0 || len(result.EndTime) == 0 {
+		return
+	}
+	startTime := getTime(result.StartTime)
+	endTime := getTime(result.EndTime)
+	if runs.FirstStartTime.IsZero() || startTime.Before(runs.FirstStartTime) {
+		runs.FirstStartTime = startTime
+	}
+	if endTime.After(runs.LastEndTime) {
+		runs.LastEndTime = endTime
+	}
+	jobName := result.Workflows.JobName
+	if latestRun, present := runs.LatestJobRuns[jobName]; !present || startTime.After(latestRun.StartTime) {
+		runs.LatestJobRuns[jobName] = startTimeAndJobStatusPair{StartTime: startTime, JobStatus: result.Status}
+	}
+}
+
+// getTimeToGreen returns the time from the start of the first job to the end of the last job
+// added so far, if the latest run of every job succeeded. Jobs without a start or an end time are ignored.
+func (runs *revisionRuns) getTimeToGreen() (time.Duration, bool) {
+	if len(runs.LatestJobRuns) == 0 {
+		return 0, false
+	}
+	for _, run := range runs.LatestJobRuns {
+		if !run.JobStatus.IsSuccess() {
+			return 0, false
+		}
+	}
+	return runs.LastEndTime.Sub(runs.FirstStartTime), true
+}
+
+// authorStatsAggregator aggregates the jobs of every author one at a time.
+type authorStatsAggregator struct {
+	params          AuthorParams
+	costModel       *CostModel
+	failureStatuses []JobStatusType
+	authorInfo      map[string]*aggregateAuthorInfo
+	revisions       map[string]*revisionRuns
+}
+
+func newAuthorStatsAggregator(params AuthorParams, costModel *CostModel,
+	failureStatuses []JobStatusType) *authorStatsAggregator {
+	return &authorStatsAggregator{
+		params:          params,
+		costModel:       costModel,
+		failureStatuses: failureStatuses,
+		authorInfo:      make(map[string]*aggregateAuthorInfo),
+		revisions:       make(map[string]*revisionRuns)}
+}
+
+func (aggregator *authorStatsAggregator) addResult(result CircleCiJobResult) {
+	author := result.getAuthor(aggregator.params.AuthorKey)
+	info, present := aggregator.authorInfo[author]
+	if !present {
+		info = &aggregateAuthorInfo{Author: author}
+		aggregator.authorInfo[author] = info
+	}
+	info.JobCount++
+	if result.Status.IsSuccess() {
+		info.SuccessCount++
+	} else if containsJobStatus(aggregator.failureStatuses, result.Status) {
+		info.FailureCount++
+	}
+	if len(result.StartTime) > 0 && len(result.EndTime) > 0 {
+		info.Duration += getJobDuration(result)
+	}
+	if aggregator.costModel != nil {
+		info.Cost += aggregator.costModel.GetCost(result)
+	}
+	if len(result.VcsRevision) > 0 {
+		key := author + "\x00" + result.VcsRevision
+		runs, present := aggregator.revisions[key]
+		if !present {
+			runs = newRevisionRuns(author)
+			aggregator.revisions[key] = runs
+		}
+		runs.addResult(result)
+	}
+}
+
+func (aggregator *authorStatsAggregator) print() {
+	params := aggregator.params
+	costModel := aggregator.costModel
+	authorInfo := aggregator.authorInfo
+	for _, runs := range aggregator.revisions {
+		if timeToGreen, isGreen := runs.getTimeToGreen(); isGreen {
+			authorInfo[runs.Author].TimesToGreen = append(authorInfo[runs.Author].TimesToGreen, timeToGreen.Seconds())
+		}
+	}
+
+	values := make([]*aggregateAuthorInfo, 0, len(authorInfo))
+	for _, v := range authorInfo {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].JobCount != values[j].JobCount {
+			// Most active author first
+			return values[i].JobCount > values[j].JobCount
+		}
+		// Sort on the basis of name to have stable outcome
+		return values[i].Author < values[j].Author
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	computeTitle := "Compute time"
+	if costModel != nil {
+		computeTitle = "Credits"
+	}
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(writer, "Author\tJobs\tFailure rate\tAverage time to green\t%s\n", computeTitle)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(writer, "------\t----\t------------\t---------------------\t%s\n", strings.Repeat("-", len(computeTitle)))
+	for i, v := range values {
+		author := v.Author
+		if params.Anonymize {
+			author = fmt.Sprintf("author-%d", i+1)
+		} else if len(author) == 0 {
+			author = "(unknown)"
+		}
+		averageTimeToGreen := "-"
+		if len(v.TimesToGreen) > 0 {
+			averageTimeToGreen = v.averageTimeToGreen().Round(time.Second).String()
+		}
+		compute := v.Duration.Round(time.Minute).String()
+		if costModel != nil {
+			compute = fmt.Sprintf("%.0f", v.Cost)
+		}
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%d\t%d%%\t%s\t%s\n",
+			author, v.JobCount, v.failureRate(), averageTimeToGreen, compute)
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
@@ -0,0 +1,156 @@
+package citool
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// No more than 100 results can be downloaded in a single Buildkite request.
+const maxBuildkitePerPage = 100
+
+// DefaultBuildkiteURL is the base URL of the Buildkite REST API.
+const DefaultBuildkiteURL = "https://api.buildkite.com"
+
+// BuildkiteDownloadParams are used for configuring parameters for downloading data from Buildkite.
+type BuildkiteDownloadParams struct {
+	BaseURL          *string
+	AccessToken      *string
+	OrganizationSlug *string
+	PipelineSlug     *string
+	BranchName       *string
+	Start            int
+	Limit            int
+	DownloadDirPath  string
+	Compression      CompressionType
+	OutputTemplate   string
+}
+
+type buildkiteBuild struct {
+	ID     string         `json:"id"`
+	Number int            `json:"number"`
+	Branch string         `json:"branch"`
+	Commit string         `json:"commit"`
+	Jobs   []buildkiteJob `json:"jobs"`
+}
+
+type buildkiteJob struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	WebURL      string `json:"web_url"`
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	ScheduledAt string `json:"scheduled_at"`
+	StartedAt   string `json:"started_at"`
+	FinishedAt  string `json:"finished_at"`
+}
+
+// DownloadBuildkiteJobResults downloads the jobs of the most recent builds of a Buildkite pipeline.
+// Start and Limit are applied to the builds and not to the jobs.
+func DownloadBuildkiteJobResults(params BuildkiteDownloadParams) *DownloadReport {
+	validateBuildkite(params)
+	writer := newDownloadWriter(newOutputLayout(params.DownloadDirPath, params.OutputTemplate, params.Compression,
+		"buildkite", "buildkite", params.OrganizationSlug, params.PipelineSlug, params.BranchName))
+	downloadInChunks(params.Start, params.Limit, maxBuildkitePerPage, func(start int, limit int) bool {
+		builds := getPagedResults[buildkiteBuild](
+			func(page int) url.URL { return constructBuildkiteBuildsURL(params, page) },
+			getBuildkiteHeaders(params), maxBuildkitePerPage, start, limit)
+		results := make([]CircleCiJobResult, 0)
+		for _, build := range builds {
+			results = append(results, getBuildkiteJobResults(params, build)...)
+		}
+		writeJobResults(writer, start, limit, results)
+		return len(builds) == limit
+	})
+	writer.logFinished()
+	return writer.report
+}
+
+func validateBuildkite(params BuildkiteDownloadParams) {
+	if IsEmpty(params.BaseURL) {
+		panic("Buildkite URL is empty")
+	}
+	if IsEmpty(params.AccessToken) {
+		panic("Buildkite access token is empty")
+	}
+	if IsEmpty(params.OrganizationSlug) || IsEmpty(params.PipelineSlug) {
+		panic("Both username(organization) and repository name(pipeline) are required for Buildkite")
+	}
+	validateStartAndLimit(params.Start, params.Limit)
+	validateOutputTemplate(params.OutputTemplate)
+}
+
+func getBuildkiteJobResults(params BuildkiteDownloadParams, build buildkiteBuild) []CircleCiJobResult {
+	results := make([]CircleCiJobResult, 0, len(build.Jobs))
+	for _, job := range build.Jobs {
+		// Skip the wait steps and the block steps, they don't run anything.
+		if job.Type != "script" && job.Type != "trigger" {
+			continue
+		}
+		results = append(results, CircleCiJobResult{
+			Username:    *params.OrganizationSlug,
+			Reponame:    *params.PipelineSlug,
+			Branch:      build.Branch,
+			BuildNumber: build.Number,
+			// Buildkite jobs don't have a number of their own
+			JobID:       job.ID,
+			BuildURL:    job.WebURL,
+			VcsRevision: build.Commit,
+			Status:      getBuildkiteJobStatus(job.State),
+			QueuedTime:  job.ScheduledAt,
+			StartTime:   job.StartedAt,
+			EndTime:     job.FinishedAt,
+			// Jobs of the same build are grouped like the jobs of a Circle CI workflow.
+			Workflows: CircleCiJobWorkflow{JobName: job.Name, WorkflowID: build.ID}})
+	}
+	return results
+}
+
+// Maps Buildkite job state to the closest Circle CI job status.
+// https://buildkite.com/docs/pipelines/defining-steps#job-states
+func getBuildkiteJobStatus(state string) JobStatusType {
+	switch state {
+	case "passed":
+		return JobStatusSuccess
+	case "failed":
+		return JobStatusFailed
+	case "canceled", "canceling":
+		return JobStatusCanceled
+	case "timed_out", "timing_out":
+		return JobStatusTimedOut
+	case "skipped", "broken", "not_run", "expired":
+		return JobStatusNotRun
+	case "blocked", "unblocked":
+		return JobStatusNotRunning
+	case "running":
+		return JobStatusRunning
+	case "scheduled":
+		return JobStatusScheduled
+	case "pending", "waiting", "waiting_failed", "assigned", "accepted", "limiting", "limited":
+		return JobStatusQueued
+	default:
+		LogWarn("Unexpected Buildkite job state", "state", state)
+		return JobStatusType(state)
+	}
+}
+
+func getBuildkiteHeaders(params BuildkiteDownloadParams) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + *params.AccessToken}
+}
+
+// https://buildkite.com/docs/apis/rest-api/builds#list-builds-for-a-pipeline
+func constructBuildkiteBuildsURL(params BuildkiteDownloadParams, page int) url.URL {
+	baseURL := fmt.Sprintf(
+		"%s/v2/organizations/%s/pipelines/%s/builds",
+		strings.TrimSuffix(*params.BaseURL, "/"),
+		url.PathEscape(*params.OrganizationSlug),
+		url.PathEscape(*params.PipelineSlug))
+	v := url.Values{}
+	v.Set("page", strconv.Itoa(page))
+	v.Set("per_page", strconv.Itoa(maxBuildkitePerPage))
+	if !IsEmpty(params.BranchName) {
+		v.Set("branch", *params.BranchName)
+	}
+	return parseURL(fmt.Sprintf("%s?%s", baseURL, v.Encode()))
+}
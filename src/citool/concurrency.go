@@ -0,0 +1,153 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Concurrency is sampled every minute.
+const concurrencySamplingInterval = time.Minute
+
+type concurrencySample struct {
+	Time         time.Time
+	RunningCount int
+	QueuedCount  int
+}
+
+// getConcurrencySamples returns the number of jobs running and queued at every minute
+// from the first queued or started job till the last job ended.
+func getConcurrencySamples(results []CircleCiJobResult) []concurrencySample {
+	var firstTime, lastTime time.Time
+	for _, result := range results {
+		if len(result.StartTime) == 0 || len(result.EndTime) == 0 {
+			continue
+		}
+		startTime := getQueuedOrStartTime(result)
+		endTime := getTime(result.EndTime)
+		if firstTime.IsZero() || startTime.Before(firstTime) {
+			firstTime = startTime
+		}
+		if endTime.After(lastTime) {
+			lastTime = endTime
+		}
+	}
+	if firstTime.IsZero() {
+		return nil
+	}
+	firstTime = firstTime.Truncate(concurrencySamplingInterval)
+	samples := make([]concurrencySample, int(lastTime.Sub(firstTime)/concurrencySamplingInterval)+1)
+	for i := range samples {
+		samples[i].Time = firstTime.Add(time.Duration(i) * concurrencySamplingInterval)
+	}
+	// Index of the first sample at or after t
+	getIndex := func(t time.Time) int {
+		return int((t.Sub(firstTime) + concurrencySamplingInterval - 1) / concurrencySamplingInterval)
+	}
+	for _, result := range results {
+		if len(result.StartTime) == 0 || len(result.EndTime) == 0 {
+			continue
+		}
+		startIndex := getIndex(getTime(result.StartTime))
+		for i := getIndex(getQueuedOrStartTime(result)); i < startIndex; i++ {
+			samples[i].QueuedCount++
+		}
+		for i := startIndex; i < getIndex(getTime(result.EndTime)); i++ {
+			samples[i].RunningCount++
+		}
+	}
+	return samples
+}
+
+// Jobs without the queued time are considered to start as soon as they are queued.
+func getQueuedOrStartTime(result CircleCiJobResult) time.Time {
+	startTime := getTime(result.StartTime)
+	if len(result.QueuedTime) == 0 {
+		return startTime
+	}
+	queuedTime := getTime(result.QueuedTime)
+	if queuedTime.After(startTime) {
+		return startTime
+	}
+	return queuedTime
+}
+
+type dailyConcurrencyInfo struct {
+	Day           string
+	RunningCounts []float64
+	QueuedCounts  []float64
+}
+
+func printConcurrency(results []CircleCiJobResult, location *time.Location) {
+	samples := getConcurrencySamples(results)
+	if len(samples) == 0 {
+		fmt.Println("No jobs with start and stop time found")
+		return
+	}
+	dailyInfo := make(map[string]*dailyConcurrencyInfo)
+	for _, sample := range samples {
+		day := sample.Time.In(location).Format("2006-01-02")
+		info, present := dailyInfo[day]
+		if !present {
+			info = &dailyConcurrencyInfo{Day: day}
+			dailyInfo[day] = info
+		}
+		info.RunningCounts = append(info.RunningCounts, float64(sample.RunningCount))
+		info.QueuedCounts = append(info.QueuedCounts, float64(sample.QueuedCount))
+	}
+	values := make([]*dailyConcurrencyInfo, 0, len(dailyInfo))
+	for _, v := range dailyInfo {
+		sort.Float64s(v.RunningCounts)
+		sort.Float64s(v.QueuedCounts)
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Day < values[j].Day
+	})
+
+	fmt.Printf("Concurrency per day in %s\n", location)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Day\tPeak running\tp95 running\tPeak queued\tp95 queued")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "---\t------------\t-----------\t-----------\t----------")
+	for _, v := range values {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%.0f\t%.0f\t%.0f\t%.0f\n", v.Day,
+			v.RunningCounts[len(v.RunningCounts)-1], getPercentile(v.RunningCounts, 95),
+			v.QueuedCounts[len(v.QueuedCounts)-1], getPercentile(v.QueuedCounts, 95))
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+
+	runningCounts := make([]float64, len(samples))
+	queuedCounts := make([]float64, len(samples))
+	for i, sample := range samples {
+		runningCounts[i] = float64(sample.RunningCount)
+		queuedCounts[i] = float64(sample.QueuedCount)
+	}
+	fmt.Printf("\nRunning jobs from %s to %s\n\n",
+		samples[0].Time.In(location).Format(time.RFC3339), samples[len(samples)-1].Time.In(location).Format(time.RFC3339))
+	printConcurrencyGraph(runningCounts)
+	fmt.Printf("\nQueued jobs\n\n")
+	printConcurrencyGraph(queuedCounts)
+	fmt.Println("")
+}
+
+// The samples are bucketed to fit the graph width, with the max of every bucket, so that
+// the peaks are not averaged out.
+func printConcurrencyGraph(counts []float64) {
+	if len(counts) > maxGraphWidth {
+		bucketedCounts := make([]float64, maxGraphWidth)
+		for i, count := range counts {
+			bucket := i * maxGraphWidth / len(counts)
+			if count > bucketedCounts[bucket] {
+				bucketedCounts[bucket] = count
+			}
+		}
+		counts = bucketedCounts
+	}
+	printGraph(counts, len(counts), maxGraphHeight)
+}
@@ -0,0 +1,246 @@
+package citool
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConfigFilename is looked up in the current directory.
+const ConfigFilename = ".citool.yaml"
+
+// Prefix of the environment variables overriding the settings, like CITOOL_CIRCLE_TOKEN for --circle-token.
+const envVarPrefix = "CITOOL_"
+
+// Sources of the settings in the order of precedence.
+const (
+	SettingSourceFlag    = "flag"
+	SettingSourceEnv     = "env"
+	SettingSourceProfile = "profile"
+	SettingSourceDefault = "default"
+)
+
+var settingSourcePrecedence = []string{SettingSourceFlag, SettingSourceEnv, SettingSourceProfile, SettingSourceDefault}
+
+// Well-known environment variables read after CITOOL_<FLAG NAME>, with the same precedence.
+var envVarAliases = map[string]string{
+	"circle-token": "CIRCLE_TOKEN",
+}
+
+// Settings which are alternative ways of setting the same value, the ones from a source of
+// a lower precedence than the others are cleared, like a token in the profile when
+// the token file is set on the command line.
+var alternativeSettings = [][]string{
+	{"circle-token", "circle-token-file", "circle-token-command"},
+}
+
+// ConfigSettings choose the config file and the profile, so they cannot be set from a profile.
+var ConfigSettings = []string{"config", "profile"}
+
+// Settings holding the access tokens.
+var secretSettings = []string{"circle-token", "gitlab-token", "jenkins-token", "buildkite-token"}
+
+// Config contains named profiles, every profile maps the flag names to their values, like
+//
+//	default_profile: celo
+//	profiles:
+//	  celo:
+//	    circle-token: XXXX
+//	    username: celo-org
+//	    reponame: celo-monorepo
+//	    print-duration-graph: false
+//	    failure-statuses: [failed, timedout]
+type Config struct {
+	DefaultProfile string                            `yaml:"default_profile"`
+	Profiles       map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// FindConfigFile returns "./.citool.yaml" or "$XDG_CONFIG_HOME/citool/config.yaml", whichever exists first.
+// Returns empty string if none of them exists.
+func FindConfigFile() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if len(configDir) == 0 {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			configDir = filepath.Join(homeDir, ".config")
+		}
+	}
+	for _, filename := range []string{ConfigFilename, filepath.Join(configDir, "citool", "config.yaml")} {
+		if fileInfo, err := os.Stat(filename); err == nil && !fileInfo.IsDir() {
+			return filename
+		}
+	}
+	return ""
+}
+
+// GetConfig reads the config from a YAML file.
+func GetConfig(filename string) *Config {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read file \"%s\"", filename))
+	}
+	var config Config
+	err2 := yaml.Unmarshal(contents, &config)
+	if err2 != nil {
+		panic(fmt.Sprintf("Failed to extract YAML from %s: %s", filename, err2))
+	}
+	return &config
+}
+
+// GetProfile returns the settings of the profile as strings, the default profile is used if profileName is empty.
+// Lists are joined with commas. Panics if the profile does not exist.
+func (config Config) GetProfile(profileName string) map[string]string {
+	if len(profileName) == 0 {
+		profileName = config.DefaultProfile
+	}
+	settings := make(map[string]string)
+	if len(profileName) == 0 {
+		return settings
+	}
+	profile, present := config.Profiles[profileName]
+	if !present {
+		panic(fmt.Sprintf("Profile \"%s\" not found in the config", profileName))
+	}
+	for name, value := range profile {
+		if values, isList := value.([]interface{}); isList {
+			strValues := make([]string, 0, len(values))
+			for _, v := range values {
+				strValues = append(strValues, fmt.Sprint(v))
+			}
+			settings[name] = strings.Join(strValues, ",")
+		} else {
+			settings[name] = fmt.Sprint(value)
+		}
+	}
+	return settings
+}
+
+// GetEnvVarName returns the environment variable overriding a flag.
+func GetEnvVarName(flagName string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplySettings sets the flags which were not set on the command line from the environment variables
+// and then from the profile settings, and returns the source of every flag.
+// Some flags can also be set from a well-known environment variable, like --circle-token from CIRCLE_TOKEN.
+// Flags in skippedFlags are left alone.
+func ApplySettings(flagSet *flag.FlagSet, profile map[string]string, skippedFlags ...string) map[string]string {
+	sources := make(map[string]string)
+	flagSet.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = SettingSourceDefault
+	})
+	flagSet.Visit(func(f *flag.Flag) {
+		sources[f.Name] = SettingSourceFlag
+	})
+	for _, name := range skippedFlags {
+		delete(sources, name)
+	}
+	for name, source := range sources {
+		if source != SettingSourceDefault {
+			continue
+		}
+		if envVarName, value, present := lookupEnvVar(name); present {
+			setFlag(flagSet, name, value, envVarName)
+			sources[name] = SettingSourceEnv
+		} else if value, present := profile[name]; present {
+			setFlag(flagSet, name, value, "profile")
+			sources[name] = SettingSourceProfile
+		}
+	}
+	for _, names := range alternativeSettings {
+		clearOverriddenSettings(flagSet, sources, names)
+	}
+	return sources
+}
+
+// lookupEnvVar returns the environment variable setting the flag, if any.
+func lookupEnvVar(flagName string) (string, string, bool) {
+	envVarName := GetEnvVarName(flagName)
+	if value, present := os.LookupEnv(envVarName); present {
+		return envVarName, value, true
+	}
+	envVarName, isAliased := envVarAliases[flagName]
+	if !isAliased {
+		return "", "", false
+	}
+	value, present := os.LookupEnv(envVarName)
+	return envVarName, value, present && len(value) > 0
+}
+
+// clearOverriddenSettings resets the settings of names which are set from a source of a lower precedence
+// than the best source of any of them.
+func clearOverriddenSettings(flagSet *flag.FlagSet, sources map[string]string, names []string) {
+	bestPrecedence := len(settingSourcePrecedence)
+	for _, name := range names {
+		source, present := sources[name]
+		if present && len(flagSet.Lookup(name).Value.String()) > 0 && getSourcePrecedence(source) < bestPrecedence {
+			bestPrecedence = getSourcePrecedence(source)
+		}
+	}
+	for _, name := range names {
+		source, present := sources[name]
+		if !present || source == SettingSourceDefault || getSourcePrecedence(source) <= bestPrecedence {
+			continue
+		}
+		LogDebug("Ignoring setting overridden by an alternative setting", "setting", name, "source", source)
+		setFlag(flagSet, name, flagSet.Lookup(name).DefValue, "default")
+		sources[name] = SettingSourceDefault
+	}
+}
+
+func getSourcePrecedence(source string) int {
+	for i, s := range settingSourcePrecedence {
+		if s == source {
+			return i
+		}
+	}
+	return len(settingSourcePrecedence)
+}
+
+func setFlag(flagSet *flag.FlagSet, name string, value string, source string) {
+	err := flagSet.Set(name, value)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid value \"%s\" of %s from %s: %s", value, name, source, err))
+	}
+}
+
+// ValidateProfile panics if a setting of the profile is not a flag of any of the flag sets
+// or is one of the ConfigSettings.
+func ValidateProfile(profile map[string]string, flagSets ...*flag.FlagSet) {
+	names := make([]string, 0, len(profile))
+	for name := range profile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if containsString(ConfigSettings, name) {
+			panic(fmt.Sprintf("Setting \"%s\" cannot be set in a profile", name))
+		}
+		isKnown := false
+		for _, flagSet := range flagSets {
+			if flagSet.Lookup(name) != nil {
+				isKnown = true
+			}
+		}
+		if !isKnown {
+			panic(fmt.Sprintf("Unknown setting \"%s\" in the profile", name))
+		}
+	}
+}
+
+// IsSecretSetting returns true for the settings which should not be printed, like the access tokens.
+func IsSecretSetting(name string) bool {
+	return containsString(secretSettings, name)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
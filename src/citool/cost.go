@@ -0,0 +1,170 @@
+package citool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// CostModel is used for estimating the cost of the jobs in Circle CI credits.
+// The credits per minute are looked up by the resource class first, then by the platform
+// and then the default is used. The cost is multiplied by the parallelism of the job.
+type CostModel struct {
+	DefaultCreditsPerMinute       float64            `json:"default_credits_per_minute"`
+	PlatformCreditsPerMinute      map[string]float64 `json:"platforms"`
+	ResourceClassCreditsPerMinute map[string]float64 `json:"resource_classes"`
+}
+
+// GetCostModel reads the cost model from a JSON file which looks like
+//
+//	{"default_credits_per_minute": 10, "platforms": {"2.0": 10}, "resource_classes": {"large": 20}}
+func GetCostModel(filename string) *CostModel {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read file \"%s\"", filename))
+	}
+	var costModel CostModel
+	err2 := json.Unmarshal(contents, &costModel)
+	if err2 != nil {
+		panic(fmt.Sprintf("Failed to extract JSON from %s: %s", filename, err2))
+	}
+	return &costModel
+}
+
+// GetCost returns the estimated cost of the job in credits.
+// Jobs which didn't run, and hence, don't have a duration don't cost anything.
+func (costModel CostModel) GetCost(result CircleCiJobResult) float64 {
+	if len(result.StartTime) == 0 || len(result.EndTime) == 0 {
+		return 0
+	}
+	creditsPerMinute := costModel.DefaultCreditsPerMinute
+	if credits, present := costModel.PlatformCreditsPerMinute[result.Platform]; present {
+		creditsPerMinute = credits
+	}
+	if credits, present := costModel.ResourceClassCreditsPerMinute[result.Picard.ResourceClass.Class]; present {
+		creditsPerMinute = credits
+	}
+	parallelism := result.Parallel
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return getJobDuration(result).Minutes() * creditsPerMinute * float64(parallelism)
+}
+
+type aggregateCostInfo struct {
+	Name        string
+	JobCount    int
+	Cost        float64
+	FailureCost float64
+	RerunCost   float64
+}
+
+func (info aggregateCostInfo) getShare(cost float64) int {
+	if info.Cost == 0 {
+		return 0
+	}
+	return int(100 * cost / info.Cost)
+}
+
+// costAggregator sums the cost of the jobs one at a time.
+type costAggregator struct {
+	costModel       CostModel
+	failureStatuses []JobStatusType
+	total           aggregateCostInfo
+	costPerJob      map[string]*aggregateCostInfo
+	costPerWorkflow map[string]*aggregateCostInfo
+	costPerBranch   map[string]*aggregateCostInfo
+	costPerUser     map[string]*aggregateCostInfo
+}
+
+func newCostAggregator(costModel CostModel, failureStatuses []JobStatusType) *costAggregator {
+	return &costAggregator{
+		costModel:       costModel,
+		failureStatuses: failureStatuses,
+		total:           aggregateCostInfo{Name: "Total"},
+		costPerJob:      make(map[string]*aggregateCostInfo),
+		costPerWorkflow: make(map[string]*aggregateCostInfo),
+		costPerBranch:   make(map[string]*aggregateCostInfo),
+		costPerUser:     make(map[string]*aggregateCostInfo)}
+}
+
+func (aggregator *costAggregator) addResult(result CircleCiJobResult) {
+	cost := aggregator.costModel.GetCost(result)
+	isFailure := containsJobStatus(aggregator.failureStatuses, result.Status)
+	isRerun := result.isRerun()
+	addCost(&aggregator.total, cost, isFailure, isRerun)
+	addCostTo(aggregator.costPerJob, result.Workflows.JobName, cost, isFailure, isRerun)
+	addCostTo(aggregator.costPerWorkflow, result.Workflows.WorkflowName, cost, isFailure, isRerun)
+	addCostTo(aggregator.costPerBranch, result.Branch, cost, isFailure, isRerun)
+	addCostTo(aggregator.costPerUser, result.User.Login, cost, isFailure, isRerun)
+}
+
+func (aggregator *costAggregator) print() {
+	total := aggregator.total
+	fmt.Printf("Estimated cost: %.0f credits (%d%% on failed jobs, %d%% on reruns)\n\n",
+		total.Cost, total.getShare(total.FailureCost), total.getShare(total.RerunCost))
+	printCostTable("Job name", aggregator.costPerJob, total.Cost)
+	fmt.Println("")
+	printCostTable("Workflow name", aggregator.costPerWorkflow, total.Cost)
+	fmt.Println("")
+	printCostTable("Branch", aggregator.costPerBranch, total.Cost)
+	fmt.Println("")
+	printCostTable("User", aggregator.costPerUser, total.Cost)
+}
+
+func addCostTo(costs map[string]*aggregateCostInfo, name string, cost float64, isFailure bool, isRerun bool) {
+	if _, present := costs[name]; !present {
+		costs[name] = &aggregateCostInfo{Name: name}
+	}
+	addCost(costs[name], cost, isFailure, isRerun)
+}
+
+func addCost(info *aggregateCostInfo, cost float64, isFailure bool, isRerun bool) {
+	info.JobCount++
+	info.Cost += cost
+	if isFailure {
+		info.FailureCost += cost
+	}
+	if isRerun {
+		info.RerunCost += cost
+	}
+}
+
+func printCostTable(title string, costs map[string]*aggregateCostInfo, totalCost float64) {
+	values := make([]*aggregateCostInfo, 0, len(costs))
+	for _, v := range costs {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Cost != values[j].Cost {
+			// Most expensive first
+			return values[i].Cost > values[j].Cost
+		}
+		// Sort on the basis of name to have stable outcome
+		return values[i].Name < values[j].Name
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(writer, "%s\tJobs\tCredits\tShare of total\tOn failed jobs\tOn reruns\n", title)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(writer, "%s\t----\t-------\t--------------\t--------------\t---------\n", strings.Repeat("-", len(title)))
+	for _, v := range values {
+		share := 0
+		if totalCost > 0 {
+			share = int(100 * v.Cost / totalCost)
+		}
+		name := v.Name
+		if len(name) == 0 {
+			name = "(unknown)"
+		}
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%d\t%.0f\t%d%%\t%d%%\t%d%%\n",
+			name, v.JobCount, v.Cost, share, v.getShare(v.FailureCost), v.getShare(v.RerunCost))
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
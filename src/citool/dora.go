@@ -0,0 +1,154 @@
+package citool
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultDeployJobPattern matches the job names like "deploy-blockchain-api".
+const DefaultDeployJobPattern = "^deploy"
+
+// Name of the row aggregating all the deploy jobs.
+const allDeployJobsName = "All deploy jobs"
+
+type doraMetrics struct {
+	JobName               string
+	DeploymentCount       int
+	FailedDeploymentCount int
+	// Number of days between the first and the last deployment, at least one.
+	PeriodInDays float64
+	// Time from the commit to the end of its first successful deployment, in seconds, sorted.
+	LeadTimes         []float64
+	MeanTimeToRestore time.Duration
+}
+
+func (metrics doraMetrics) deploymentsPerDay() float64 {
+	return float64(metrics.DeploymentCount) / metrics.PeriodInDays
+}
+
+func (metrics doraMetrics) changeFailureRate() int {
+	attemptCount := metrics.DeploymentCount + metrics.FailedDeploymentCount
+	if attemptCount == 0 {
+		return 0
+	}
+	return 100 * metrics.FailedDeploymentCount / attemptCount
+}
+
+// getDoraMetrics computes the metrics using the jobs matching deployJobPattern as the deployments.
+// The results should be filtered on the release branch.
+func getDoraMetrics(results []CircleCiJobResult, deployJobPattern *regexp.Regexp,
+	failureStatuses []JobStatusType) []doraMetrics {
+	deployResults := make(map[string][]CircleCiJobResult)
+	for _, result := range results {
+		if !deployJobPattern.MatchString(result.Workflows.JobName) {
+			continue
+		}
+		if !result.Status.IsSuccess() && !containsJobStatus(failureStatuses, result.Status) {
+			continue
+		}
+		if len(result.StartTime) == 0 || len(result.EndTime) == 0 {
+			continue
+		}
+		deployResults[result.Workflows.JobName] = append(deployResults[result.Workflows.JobName], result)
+		deployResults[allDeployJobsName] = append(deployResults[allDeployJobsName], result)
+	}
+
+	values := make([]doraMetrics, 0, len(deployResults))
+	for jobName, value := range deployResults {
+		metrics := doraMetrics{JobName: jobName, PeriodInDays: 1}
+		firstStartTime := getTime(value[0].StartTime)
+		lastStartTime := firstStartTime
+		// Lead time of a revision is till its first deployment.
+		leadTimes := make(map[string]time.Duration)
+		for _, result := range value {
+			startTime := getTime(result.StartTime)
+			if startTime.Before(firstStartTime) {
+				firstStartTime = startTime
+			}
+			if startTime.After(lastStartTime) {
+				lastStartTime = startTime
+			}
+			if !result.Status.IsSuccess() {
+				metrics.FailedDeploymentCount++
+				continue
+			}
+			metrics.DeploymentCount++
+			if len(result.CommitterDate) == 0 {
+				continue
+			}
+			leadTime := getTime(result.EndTime).Sub(getTime(result.CommitterDate))
+			if existingLeadTime, present := leadTimes[result.VcsRevision]; !present || leadTime < existingLeadTime {
+				leadTimes[result.VcsRevision] = leadTime
+			}
+		}
+		metrics.PeriodInDays = math.Max(1, lastStartTime.Sub(firstStartTime).Hours()/24)
+		for _, leadTime := range leadTimes {
+			metrics.LeadTimes = append(metrics.LeadTimes, leadTime.Seconds())
+		}
+		sort.Float64s(metrics.LeadTimes)
+		metrics.MeanTimeToRestore = getMeanTimeToRestore(value, failureStatuses)
+		values = append(values, metrics)
+	}
+	return values
+}
+
+// Time to restore is the time to recovery of the deploy jobs.
+func getMeanTimeToRestore(deployResults []CircleCiJobResult, failureStatuses []JobStatusType) time.Duration {
+	totalDuration := time.Duration(0)
+	recoveredCount := 0
+	for _, info := range getJobRecoveryInfo(deployResults, failureStatuses) {
+		for _, streak := range info.Streaks {
+			if streak.isRecovered() {
+				totalDuration += streak.RecoveryTime.Sub(streak.StartTime)
+				recoveredCount++
+			}
+		}
+	}
+	if recoveredCount == 0 {
+		return 0
+	}
+	return totalDuration / time.Duration(recoveredCount)
+}
+
+func printDoraMetrics(results []CircleCiJobResult, deployJobPattern *regexp.Regexp,
+	failureStatuses []JobStatusType) {
+	values := getDoraMetrics(results, deployJobPattern, failureStatuses)
+	if len(values) == 0 {
+		fmt.Printf("No deploy jobs matching \"%s\" found\n", deployJobPattern)
+		return
+	}
+	sort.Slice(values, func(i, j int) bool {
+		// Aggregate row last
+		if (values[i].JobName == allDeployJobsName) != (values[j].JobName == allDeployJobsName) {
+			return values[j].JobName == allDeployJobsName
+		}
+		return values[i].JobName < values[j].JobName
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Deploy job\tDeployments\tDeployment frequency\tMedian lead time\tChange failure rate\tMean time to restore")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "----------\t-----------\t--------------------\t----------------\t-------------------\t--------------------")
+	for _, v := range values {
+		medianLeadTime := "-"
+		if len(v.LeadTimes) > 0 {
+			medianLeadTime = time.Duration(getPercentile(v.LeadTimes, 50) * float64(time.Second)).Round(time.Minute).String()
+		}
+		meanTimeToRestore := "-"
+		if v.MeanTimeToRestore > 0 {
+			meanTimeToRestore = v.MeanTimeToRestore.Round(time.Minute).String()
+		}
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%d\t%.2f/day\t%s\t%d%%\t%s\n",
+			v.JobName, v.DeploymentCount, v.deploymentsPerDay(), medianLeadTime,
+			v.changeFailureRate(), meanTimeToRestore)
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
@@ -1,6 +1,7 @@
 package citool
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,8 +17,13 @@ import (
 const maxDownloadCircleCiLimit = 100
 const maxFetchRetryCount = 5
 
+// DefaultCircleCiURL is the base URL of the Circle CI API.
+const DefaultCircleCiURL = "https://circleci.com"
+
 // DownloadParams are used for configuring parameters for downloading data from Circle CI.
 type DownloadParams struct {
+	// Base URL of the Circle CI API, DefaultCircleCiURL for Circle CI cloud.
+	BaseURL         *string
 	CircleToken     *string
 	VcsType         *string
 	Username        *string
@@ -26,32 +33,74 @@ type DownloadParams struct {
 	Limit           int
 	DownloadDirPath string
 	JobStatus       *JobStatusFilterTypes
+	// Compression of the written pages, the file names get the ".gz" or ".zst" suffix.
+	Compression CompressionType
+	// Path of the pages relative to DownloadDirPath with the placeholders {provider}, {vcs}, {username},
+	// {repo}, {branch}, {date}, {start} and {end}, DefaultOutputTemplate if empty.
+	OutputTemplate string
+	// Download test metadata of every finished build to the "tests/<username>/<reponame>" sub-directory as well.
+	DownloadTests bool
+	// Download the full build results instead of the shallow ones.
+	Deep bool
+	// Fetch every finished build individually to get the build details like the steps.
+	DownloadBuildDetails bool
+	// Download output of the failed steps to the "logs/<username>/<reponame>" sub-directory as well.
+	// Requires DownloadBuildDetails.
+	DownloadFailureLogs bool
 }
 
-// DownloadCircleCIJobResults performs the downloading of the build results.
-func DownloadCircleCIJobResults(params DownloadParams) {
+// DownloadCircleCIJobResults performs the downloading of the build results and returns the report of
+// the written files.
+func DownloadCircleCIJobResults(params DownloadParams) *DownloadReport {
 	validate(params)
+	writer := newDownloadWriter(newOutputLayout(params.DownloadDirPath, params.OutputTemplate, params.Compression,
+		"circleci", *params.VcsType, params.Username, params.RepositoryName, params.BranchName))
 
-	start := params.Start
-	end := start + params.Limit - 1
+	downloadInChunks(params.Start, params.Limit, maxDownloadCircleCiLimit, func(start int, limit int) bool {
+		tmpDownloadParams := params
+		tmpDownloadParams.Start = start
+		tmpDownloadParams.Limit = limit
+		downloadCircleCIBuildResults(tmpDownloadParams, writer)
+		return true
+	})
+	writer.logFinished()
+	return writer.report
+}
 
+// downloadInChunks calls downloadChunk for consecutive chunks of at most chunkSize results
+// till limit results starting from start are covered. Each chunk is written to a separate file.
+// downloadChunk returns false if there is nothing more to download.
+func downloadInChunks(start int, limit int, chunkSize int, downloadChunk func(start int, limit int) bool) {
+	end := start + limit - 1
 	for start <= end {
 		numToDownload := end - start + 1
-		if numToDownload > maxDownloadCircleCiLimit {
-			numToDownload = maxDownloadCircleCiLimit
+		if numToDownload > chunkSize {
+			numToDownload = chunkSize
 		}
-		tmpDownloadParams := params
-		tmpDownloadParams.Start = start
-		tmpDownloadParams.Limit = numToDownload
-		LogDebug(fmt.Sprintf("Downloading from %d to %d (both inclusive)", start, start+numToDownload-1))
-		downloadCircleCIBuildResults(tmpDownloadParams)
-		start += maxDownloadCircleCiLimit
+		LogDebug("Downloading chunk", "start", start, "end", start+numToDownload-1)
+		if !downloadChunk(start, numToDownload) {
+			LogDebug("Nothing more to download")
+			break
+		}
+		start += chunkSize
+	}
+}
+
+// validateStartAndLimit validates the download range which is common to all the providers.
+func validateStartAndLimit(start int, limit int) {
+	if start < 0 {
+		panic(fmt.Sprintf("start offset cannot be negative, it is %d", start))
+	}
+	if limit <= 0 {
+		panic(fmt.Sprintf("limit must be > 0, it is %d", limit))
 	}
-	LogDebug("Downloading finished")
 }
 
 func validate(params DownloadParams) {
 	// Validate
+	if IsEmpty(params.BaseURL) {
+		panic("Circle CI URL is empty")
+	}
 	if IsEmpty(params.CircleToken) {
 		panic("Circle CI token is empty")
 	}
@@ -72,45 +121,165 @@ func validate(params DownloadParams) {
 			panic(fmt.Sprintf("branchname(\"%s\") cannot be provided without username or respositry name", *params.BranchName))
 		}
 	}
-	if params.Start < 0 {
-		panic(fmt.Sprintf("start offset cannot be negative, it is %d", params.Start))
-	}
-	if params.Limit <= 0 {
-		panic(fmt.Sprintf("limit must be > 0, it is %d", params.Limit))
+	validateStartAndLimit(params.Start, params.Limit)
+	validateOutputTemplate(params.OutputTemplate)
+	if params.DownloadFailureLogs && !params.DownloadBuildDetails {
+		panic("Build details are required for downloading failure logs")
 	}
 }
 
-// Works - "https://circleci.com/api/v1.1/project/github/celo-org/celo-monpo?circle-token=${TOKEN}&limit=1&offset=5&filter=running&shallow=true"
-// Fails - "https://circleci.com/api/v1.1/project/github/celo-org/celo-monorepo/tree/master?circle-token=25b7d2f03ad0a5c9cf2a2f4740211aaf3c4d59af&filter=running&limit=1&offset=5
-func downloadCircleCIBuildResults(params DownloadParams) {
+// Works - "https://circleci.com/api/v1.1/project/github/celo-org/celo-monpo?limit=1&offset=5&filter=running&shallow=true"
+// Fails - "https://circleci.com/api/v1.1/project/github/celo-org/celo-monorepo/tree/master?filter=running&limit=1&offset=5
+func downloadCircleCIBuildResults(params DownloadParams, writer downloadWriter) {
 	var downloadURL *url.URL
 	if IsEmpty(params.Username) {
 		downloadURL = constructDownloadURLForAllProjects(params)
 	} else {
 		downloadURL = constructDownloadURLForASpecificProject(params)
 	}
-	LogDebug(fmt.Sprintf("Downloading from %s", downloadURL.String()))
-	data, err := getBody(*downloadURL)
+	LogDebug("Downloading builds", "url", downloadURL.String())
+	data, err := getCircleCIBody(params, *downloadURL)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to download from %s, error: %s", downloadURL, err))
 	}
-	outputFilename := getOutputFilename(params.DownloadDirPath, params.Start, params.Limit)
-	err2 := writeToFile(outputFilename, data)
-	if err2 == nil {
-		LogDebug(fmt.Sprintf("Write %s", outputFilename))
-	} else {
-		LogDebug(fmt.Sprintf("Error while writing %s is %s", outputFilename, err2))
+	if params.DownloadBuildDetails {
+		data = downloadCircleCIBuildDetails(params, writer, data)
+	}
+	var results []CircleCiJobResult
+	err2 := json.Unmarshal(data, &results)
+	if err2 != nil {
+		panic("Failed to extract JSON" + err2.Error())
+	}
+	writer.writePage(params.Start, params.Limit, data, len(results))
+	if params.DownloadTests {
+		downloadCircleCITestResults(params, writer, results)
+	}
+}
+
+// Statuses of the finished builds whose failed steps can be categorised.
+var failedStepStatuses = []JobStatusType{JobStatusFailed, JobStatusTimedOut, JobStatusInfrastructureFail}
+
+// downloadCircleCIBuildDetails replaces every finished build in the downloaded page with the
+// build details fetched individually and returns the modified page.
+func downloadCircleCIBuildDetails(params DownloadParams, writer downloadWriter, data []byte) []byte {
+	var rawResults []json.RawMessage
+	var results []CircleCiJobResult
+	err := json.Unmarshal(data, &rawResults)
+	if err == nil {
+		err = json.Unmarshal(data, &results)
 	}
+	if err != nil {
+		panic("Failed to extract JSON" + err.Error())
+	}
+	for i, result := range results {
+		// Only the finished builds have all the steps.
+		if result.Status != JobStatusSuccess && !containsJobStatus(failedStepStatuses, result.Status) {
+			continue
+		}
+		buildURL := constructBuildURL(params, result)
+		LogDebug("Downloading build details", "url", buildURL.String(), "build", result.BuildNumber)
+		buildData, err := getCircleCIBody(params, buildURL)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to download from %s, error: %s", buildURL.String(), err))
+		}
+		rawResults[i] = buildData
+		if params.DownloadFailureLogs && containsJobStatus(failedStepStatuses, result.Status) {
+			downloadCircleCIFailureLogs(params, writer, buildData)
+		}
+	}
+	data, err = json.Marshal(rawResults)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to convert build details to JSON, error: %s", err))
+	}
+	return data
+}
+
+type circleCiActionOutput struct {
+	Message string `json:"message"`
+}
+
+// downloadCircleCIFailureLogs downloads the output of the failed steps of a build to
+// "logs/<username>/<reponame>/<build number>.txt", the format expected by the failure categorisation.
+func downloadCircleCIFailureLogs(params DownloadParams, writer downloadWriter, buildData []byte) {
+	var result CircleCiJobResult
+	err := json.Unmarshal(buildData, &result)
+	if err != nil {
+		panic("Failed to extract JSON" + err.Error())
+	}
+	logs := make([]byte, 0)
+	for _, step := range result.Steps {
+		for _, action := range step.Actions {
+			if !action.hasFailed() || len(action.OutputURL) == 0 {
+				continue
+			}
+			// Output URL is pre-signed and does not need the token.
+			outputURL := parseURL(action.OutputURL)
+			LogDebug("Downloading step output", "build", result.BuildNumber, "step", step.Name)
+			data, err := getBody(outputURL)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to download output of build %d, error: %s", result.BuildNumber, err))
+			}
+			var outputs []circleCiActionOutput
+			err2 := json.Unmarshal(data, &outputs)
+			if err2 != nil {
+				panic("Failed to extract JSON" + err2.Error())
+			}
+			for _, output := range outputs {
+				logs = append(logs, output.Message...)
+			}
+		}
+	}
+	logsDirPath := getBuildFilesDir(filepath.Join(params.DownloadDirPath, FailureLogsDirName), result)
+	writer.writeFile(getFailureLogsFilename(logsDirPath, result), logs)
+}
+
+// https://circleci.com/docs/api/#single-job
+func constructBuildURL(params DownloadParams, result CircleCiJobResult) url.URL {
+	baseURL := fmt.Sprintf(
+		"%s/api/v1.1/project/%s/%s/%s/%d",
+		strings.TrimSuffix(*params.BaseURL, "/"),
+		url.PathEscape(*params.VcsType),
+		url.PathEscape(result.Username),
+		url.PathEscape(result.Reponame),
+		result.BuildNumber)
+	return parseURL(baseURL)
+}
+
+func downloadCircleCITestResults(params DownloadParams, writer downloadWriter, results []CircleCiJobResult) {
+	for _, result := range results {
+		// Only the finished builds have test results.
+		if result.Status != JobStatusSuccess && result.Status != JobStatusFailed {
+			continue
+		}
+		testsURL := constructTestsURL(params, result)
+		LogDebug("Downloading tests", "url", testsURL.String(), "build", result.BuildNumber)
+		data, err := getCircleCIBody(params, testsURL)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to download from %s, error: %s", testsURL.String(), err))
+		}
+		writer.writeFile(getTestResultsFilename(params.DownloadDirPath, result), data)
+	}
+}
+
+// https://circleci.com/docs/api/#get-build-tests
+func constructTestsURL(params DownloadParams, result CircleCiJobResult) url.URL {
+	baseURL := fmt.Sprintf(
+		"%s/api/v1.1/project/%s/%s/%s/%d/tests",
+		strings.TrimSuffix(*params.BaseURL, "/"),
+		url.PathEscape(*params.VcsType),
+		url.PathEscape(result.Username),
+		url.PathEscape(result.Reponame),
+		result.BuildNumber)
+	return parseURL(baseURL)
 }
 
 // https://circleci.com/docs/api/#recent-builds-across-all-projects
 func constructDownloadURLForAllProjects(params DownloadParams) *url.URL {
-	baseURL := "https://circleci.com/api/v1.1/recent-builds"
+	baseURL := strings.TrimSuffix(*params.BaseURL, "/") + "/api/v1.1/recent-builds"
 	v := url.Values{}
-	v.Set("circle-token", *params.CircleToken)
 	v.Set("offset", strconv.Itoa(params.Start))
 	v.Set("limit", strconv.Itoa(params.Limit))
-	v.Set("shallow", "true")
+	v.Set("shallow", strconv.FormatBool(!params.Deep))
 	queryString := v.Encode()
 	downloadURLString := fmt.Sprintf("%s?%s", baseURL, queryString)
 	downloadURL, err := url.Parse(downloadURLString)
@@ -123,7 +292,8 @@ func constructDownloadURLForAllProjects(params DownloadParams) *url.URL {
 // https://circleci.com/docs/api/#recent-builds-for-a-single-project
 func constructDownloadURLForASpecificProject(params DownloadParams) *url.URL {
 	baseURL := fmt.Sprintf(
-		"https://circleci.com/api/v1.1/project/%s/%s/%s",
+		"%s/api/v1.1/project/%s/%s/%s",
+		strings.TrimSuffix(*params.BaseURL, "/"),
 		url.PathEscape(*params.VcsType),
 		url.PathEscape(*params.Username),
 		url.PathEscape(*params.RepositoryName))
@@ -131,10 +301,9 @@ func constructDownloadURLForASpecificProject(params DownloadParams) *url.URL {
 		baseURL = fmt.Sprintf("%s/tree/%s", baseURL, url.PathEscape(*params.BranchName))
 	}
 	v := url.Values{}
-	v.Set("circle-token", *params.CircleToken)
 	v.Set("offset", strconv.Itoa(params.Start))
 	v.Set("limit", strconv.Itoa(params.Limit))
-	v.Set("shallow", "true")
+	v.Set("shallow", strconv.FormatBool(!params.Deep))
 	if params.JobStatus != nil {
 		v.Set("filter", string(*params.JobStatus))
 	}
@@ -147,25 +316,58 @@ func constructDownloadURLForASpecificProject(params DownloadParams) *url.URL {
 	return downloadURL
 }
 
+// writeToFile writes to a temporary file in the same directory and renames it to filename,
+// so that filename is never left partially written.
 func writeToFile(filename string, contents []byte) error {
-	// Create up to one parent if required
-	maybeCreateDirectory(filepath.Dir(filename))
-	return os.WriteFile(filename, contents, 0644)
-}
-
-func maybeCreateDirectory(dirpath string) bool {
-	if len(dirpath) == 0 || dirpath == ".." || dirpath == string(filepath.Separator) {
-		return false
+	// Create all the parents if required
+	dirname := filepath.Dir(filename)
+	err := os.MkdirAll(dirname, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	// Hidden and without the input file suffixes, so that the analyze mode never reads it
+	file, err := os.CreateTemp(dirname, "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(contents)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filename)
 	}
-	return os.Mkdir(dirpath, os.ModePerm) == nil
+	if err != nil {
+		//noinspection GoUnhandledErrorResult
+		os.Remove(file.Name())
+	}
+	return err
 }
 
-// TODO: make this more customizable
-func getOutputFilename(downloadDirPath string, start int, limit int) string {
-	return fmt.Sprintf(filepath.Join(downloadDirPath, "from-%d-to-%d.json"), start, start+limit-1)
+// Test results are stored as "tests/<username>/<reponame>/<build number>.json", the format expected by GetTestResults.
+func getTestResultsFilename(downloadDirPath string, result CircleCiJobResult) string {
+	testResultsDirPath := getBuildFilesDir(filepath.Join(downloadDirPath, TestResultsDirName), result)
+	return filepath.Join(testResultsDirPath, getBuildFilename(result)+".json")
 }
 
 func getBody(url url.URL) ([]byte, error) {
+	return getBodyWithHeaders(url, nil)
+}
+
+// getCircleCIBody sends the token in the header, so that it does not end up in the logs with the URL.
+func getCircleCIBody(params DownloadParams, url url.URL) ([]byte, error) {
+	return getBodyWithHeaders(url, map[string]string{"Circle-Token": *params.CircleToken})
+}
+
+// getBodyWithHeaders is same as getBody but sets the extra request headers as well, this is
+// used by the providers which expect the access token in a header.
+func getBodyWithHeaders(url url.URL, headers map[string]string) ([]byte, error) {
 	urlString := url.String()
 	var err error
 	retryCount := 0
@@ -179,9 +381,12 @@ func getBody(url url.URL) ([]byte, error) {
 		}
 		// Or else the response is in some weird format.
 		request.Header.Set("Accept", "application/json")
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
 		response, err2 := client.Do(request)
 		if err2 != nil {
-			fmt.Printf("Failed to fetch on %d try: url \"%s\"\n", retryCount, urlString)
+			LogWarn("Failed to fetch", "url", urlString, "try", retryCount, "error", err2)
 			err = err2
 			continue
 		}
@@ -190,7 +395,7 @@ func getBody(url url.URL) ([]byte, error) {
 		}
 		bodyBytes, err3 := io.ReadAll(response.Body)
 		if err3 != nil {
-			fmt.Printf("Failed to fetch on %d try: %s\n", retryCount, urlString)
+			LogWarn("Failed to fetch", "url", urlString, "try", retryCount, "error", err3)
 			err = err3
 			continue
 		}
@@ -198,3 +403,50 @@ func getBody(url url.URL) ([]byte, error) {
 	}
 	return nil, err
 }
+
+// getPagedResults fetches pages of JSON arrays using pageURL and returns up to limit results
+// after skipping the first offset results. It stops on the first page which has fewer than
+// perPage results since that's the last page.
+func getPagedResults[T any](pageURL func(page int) url.URL, headers map[string]string,
+	perPage int, offset int, limit int) []T {
+	results := make([]T, 0)
+	// Pages are 1-indexed, skip the pages which are completely before the offset.
+	skipped := offset - offset%perPage
+	for page := offset/perPage + 1; len(results) < limit; page++ {
+		pageURL := pageURL(page)
+		LogDebug("Downloading page", "url", pageURL.String(), "page", page)
+		data, err := getBodyWithHeaders(pageURL, headers)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to download from %s, error: %s", pageURL.String(), err))
+		}
+		var pageResults []T
+		err2 := json.Unmarshal(data, &pageResults)
+		if err2 != nil {
+			panic("Failed to extract JSON" + err2.Error())
+		}
+		for _, result := range pageResults {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			if len(results) >= limit {
+				break
+			}
+			results = append(results, result)
+		}
+		if len(pageResults) < perPage {
+			break
+		}
+	}
+	return results
+}
+
+// writeJobResults stores the job results in the same format as the downloaded Circle CI
+// results so that the analyze mode works identically on them.
+func writeJobResults(writer downloadWriter, start int, limit int, results []CircleCiJobResult) {
+	data, err := json.Marshal(results)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to convert job results to JSON, error: %s", err))
+	}
+	writer.writePage(start, limit, data, len(results))
+}
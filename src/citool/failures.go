@@ -0,0 +1,151 @@
+package citool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+)
+
+const unclassifiedFailureCategory = "unclassified"
+
+// FailureCategory is a named set of regular expressions matching the output of the failed steps.
+type FailureCategory struct {
+	Name     string   `json:"name"`
+	Patterns []string `json:"patterns"`
+	regexps  []*regexp.Regexp
+}
+
+type failureRules struct {
+	Categories []FailureCategory `json:"categories"`
+}
+
+// GetFailureCategories reads the failure categories from the rules file which looks like
+//
+//	{"categories": [{"name": "OOM killed", "patterns": ["(?i)out of memory", "exit code 137"]}]}
+//
+// The categories are tried in order and the first matching one is used for a failure.
+func GetFailureCategories(filename string) []FailureCategory {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read file \"%s\"", filename))
+	}
+	var rules failureRules
+	err2 := json.Unmarshal(contents, &rules)
+	if err2 != nil {
+		panic(fmt.Sprintf("Failed to extract JSON from %s: %s", filename, err2))
+	}
+	for i, category := range rules.Categories {
+		if category.Name == unclassifiedFailureCategory {
+			panic(fmt.Sprintf("Failure category name \"%s\" is reserved", unclassifiedFailureCategory))
+		}
+		for _, pattern := range category.Patterns {
+			rules.Categories[i].regexps = append(rules.Categories[i].regexps, regexp.MustCompile(pattern))
+		}
+	}
+	return rules.Categories
+}
+
+// getFailureLogsFilename returns the file containing the output of the failed steps of a build.
+func getFailureLogsFilename(logsDirPath string, result CircleCiJobResult) string {
+	return filepath.Join(logsDirPath, getBuildFilename(result)+".txt")
+}
+
+func (action CircleCiStepAction) hasFailed() bool {
+	return action.Failed || action.Status == string(JobStatusFailed)
+}
+
+func (category FailureCategory) matches(logs []byte) bool {
+	for _, re := range category.regexps {
+		if re.Match(logs) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the first category matching the logs of the failed job.
+func getFailureCategory(result CircleCiJobResult, categories []FailureCategory, logsDirPath string) string {
+	logs, err := os.ReadFile(getFailureLogsFilename(getBuildFilesDir(logsDirPath, result), result))
+	if os.IsNotExist(err) {
+		// Stored only by the build number
+		logs, err = os.ReadFile(getFailureLogsFilename(logsDirPath, result))
+	}
+	if err != nil {
+		LogDebug("No failure logs", "build", result.BuildNumber, "error", err)
+		return unclassifiedFailureCategory
+	}
+	for _, category := range categories {
+		if category.matches(logs) {
+			return category.Name
+		}
+	}
+	return unclassifiedFailureCategory
+}
+
+type failureCategoryCount struct {
+	JobName  string
+	Category string
+	Count    int
+}
+
+func printFailureCategories(results []CircleCiJobResult, failureStatuses []JobStatusType,
+	categories []FailureCategory, logsDirPath string) {
+	counts := make(map[string]map[string]int)
+	unclassifiedBuildURLs := make([]string, 0)
+	for _, result := range results {
+		if !containsJobStatus(failureStatuses, result.Status) {
+			continue
+		}
+		jobName := result.Workflows.JobName
+		category := getFailureCategory(result, categories, logsDirPath)
+		if _, present := counts[jobName]; !present {
+			counts[jobName] = make(map[string]int)
+		}
+		counts[jobName][category]++
+		if category == unclassifiedFailureCategory {
+			unclassifiedBuildURLs = append(unclassifiedBuildURLs, result.BuildURL)
+		}
+	}
+
+	values := make([]failureCategoryCount, 0)
+	for jobName, categoryCounts := range counts {
+		for category, count := range categoryCounts {
+			values = append(values, failureCategoryCount{jobName, category, count})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].JobName != values[j].JobName {
+			return values[i].JobName < values[j].JobName
+		}
+		if values[i].Count != values[j].Count {
+			// Most frequent category first
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Category < values[j].Category
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Job name\tFailure category\tFailures")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "--------\t----------------\t--------")
+	for _, v := range values {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%s\t%d\n", v.JobName, v.Category, v.Count)
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+
+	if len(unclassifiedBuildURLs) > 0 {
+		sort.Strings(unclassifiedBuildURLs)
+		fmt.Printf("\nUnclassified failures (%d)\n", len(unclassifiedBuildURLs))
+		for _, buildURL := range unclassifiedBuildURLs {
+			fmt.Println(buildURL)
+		}
+	}
+	fmt.Println("")
+}
@@ -17,6 +17,12 @@ type FilterParams struct {
 
 // FilterData filters the results field in-place using filterParams.
 func (filterParams FilterParams) FilterData(results *[]CircleCiJobResult) {
+	filterParams.LogFilters()
+	filter.ChooseInPlace(results, filterParams.Matches)
+}
+
+// LogFilters logs the filters which are set.
+func (filterParams FilterParams) LogFilters() {
 	username := filterParams.Username
 	repositoryName := filterParams.RepositoryName
 	branchName := filterParams.BranchName
@@ -24,25 +30,24 @@ func (filterParams FilterParams) FilterData(results *[]CircleCiJobResult) {
 	jobStatus := filterParams.JobStatus
 
 	if !IsEmpty(username) {
-		LogDebug("Filtering on username: " + *username)
+		LogDebug("Filtering", "username", *username)
 	}
 	if !IsEmpty(repositoryName) {
-		LogDebug("Filtering on repository name: " + *repositoryName)
+		LogDebug("Filtering", "reponame", *repositoryName)
 	}
 	if !IsEmpty(branchName) {
-		LogDebug("Filtering on branch: " + *branchName)
+		LogDebug("Filtering", "branch", *branchName)
 	}
 	if !IsEmpty(jobname) {
-		LogDebug("Filtering on job name: " + *jobname)
+		LogDebug("Filtering", "job", *jobname)
 	}
 	if !IsEmpty(jobStatus) {
-		LogDebug("Filtering on job result: " + *jobStatus)
+		LogDebug("Filtering", "status", *jobStatus)
 	}
-
-	filter.ChooseInPlace(results, filterParams.filterRule)
 }
 
-func (filterParams FilterParams) filterRule(result CircleCiJobResult) bool {
+// Matches returns true if result passes all the filters.
+func (filterParams FilterParams) Matches(result CircleCiJobResult) bool {
 	username := filterParams.Username
 	repositoryName := filterParams.RepositoryName
 	branchName := filterParams.BranchName
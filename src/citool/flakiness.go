@@ -0,0 +1,122 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// flakyTestInfo is a test case which both passed and failed on the same VCS revision.
+type flakyTestInfo struct {
+	TestName string
+	JobName  string
+	// Number of revisions on which the test both passed and failed.
+	FlakyRevisionCount int
+	// Number of revisions on which the test ran more than once.
+	RerunRevisionCount int
+	// Number of times the result changed from pass to fail or vice versa on the same revision.
+	FlipCount        int
+	FirstFailureTime time.Time
+	LastFailureTime  time.Time
+}
+
+// getFlakyTests returns the tests which flipped between pass and fail on the same revision,
+// the most flaky test first.
+func getFlakyTests(aggregateInfos []*aggregateTestInfo) []flakyTestInfo {
+	flakyTests := make([]flakyTestInfo, 0)
+	for _, info := range aggregateInfos {
+		flakyTest := flakyTestInfo{TestName: info.TestName, JobName: info.JobName}
+		// Runs are in chronological order, so, the runs of each revision are as well.
+		runsPerRevision := make(map[string][]testCaseRun)
+		for _, run := range info.Runs {
+			if run.Failed {
+				if flakyTest.FirstFailureTime.IsZero() {
+					flakyTest.FirstFailureTime = run.StartTime
+				}
+				flakyTest.LastFailureTime = run.StartTime
+			}
+			// Runs without a revision cannot be compared with each other.
+			if len(run.VcsRevision) > 0 {
+				runsPerRevision[run.VcsRevision] = append(runsPerRevision[run.VcsRevision], run)
+			}
+		}
+		for _, runs := range runsPerRevision {
+			if len(runs) < 2 {
+				continue
+			}
+			flakyTest.RerunRevisionCount++
+			flipCount := 0
+			for i := 1; i < len(runs); i++ {
+				if runs[i].Failed != runs[i-1].Failed {
+					flipCount++
+				}
+			}
+			if flipCount > 0 {
+				flakyTest.FlakyRevisionCount++
+				flakyTest.FlipCount += flipCount
+			}
+		}
+		if flakyTest.FlipCount > 0 {
+			flakyTests = append(flakyTests, flakyTest)
+		}
+	}
+
+	sort.Slice(flakyTests, func(i, j int) bool {
+		if flakyTests[i].FlakyRevisionCount != flakyTests[j].FlakyRevisionCount {
+			return flakyTests[i].FlakyRevisionCount > flakyTests[j].FlakyRevisionCount
+		}
+		if flakyTests[i].FlipCount != flakyTests[j].FlipCount {
+			return flakyTests[i].FlipCount > flakyTests[j].FlipCount
+		}
+		// Sort on the basis of name to have stable outcome
+		if flakyTests[i].JobName != flakyTests[j].JobName {
+			return flakyTests[i].JobName < flakyTests[j].JobName
+		}
+		return flakyTests[i].TestName < flakyTests[j].TestName
+	})
+	return flakyTests
+}
+
+func printFlakyTests(flakyTests []flakyTestInfo) {
+	fmt.Printf("Number of flaky tests: %d\n", len(flakyTests))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Test name\tJob name\tFlaky revisions\tFlips\tFirst failure\tLast failure")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "---------\t--------\t---------------\t-----\t-------------\t------------")
+	for _, v := range flakyTests {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%s\t%d/%d\t%d\t%s\t%s\n",
+			v.TestName, v.JobName, v.FlakyRevisionCount, v.RerunRevisionCount, v.FlipCount,
+			v.FirstFailureTime.Format(time.DateOnly), v.LastFailureTime.Format(time.DateOnly))
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+	fmt.Println("")
+}
+
+// writeQuarantineFile writes the sorted unique names of the flaky tests, one per line,
+// for the test runners to skip them.
+func writeQuarantineFile(filename string, flakyTests []flakyTestInfo) {
+	testNames := make(map[string]bool)
+	for _, flakyTest := range flakyTests {
+		testNames[flakyTest.TestName] = true
+	}
+	sortedTestNames := make([]string, 0, len(testNames))
+	for testName := range testNames {
+		sortedTestNames = append(sortedTestNames, testName)
+	}
+	sort.Strings(sortedTestNames)
+	contents := strings.Join(sortedTestNames, "\n")
+	if len(contents) > 0 {
+		contents += "\n"
+	}
+	err := writeToFile(filename, []byte(contents))
+	if err != nil {
+		panic(fmt.Sprintf("Failed to write quarantine list to %s, error: %s", filename, err))
+	}
+	LogInfo("Wrote quarantine list", "file", filename, "tests", len(sortedTestNames))
+}
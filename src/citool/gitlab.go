@@ -0,0 +1,202 @@
+package citool
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// No more than 100 results can be downloaded in a single GitLab request.
+const maxGitLabPerPage = 100
+
+// DefaultGitLabURL is the base URL of the hosted GitLab instance.
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLabDownloadParams are used for configuring parameters for downloading data from GitLab.
+type GitLabDownloadParams struct {
+	BaseURL         *string
+	PrivateToken    *string
+	Username        *string
+	RepositoryName  *string
+	BranchName      *string
+	Start           int
+	Limit           int
+	DownloadDirPath string
+	Compression     CompressionType
+	OutputTemplate  string
+}
+
+type gitLabPipeline struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Ref    string `json:"ref"`
+	Sha    string `json:"sha"`
+}
+
+type gitLabUser struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+type gitLabJob struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	FailureReason string     `json:"failure_reason"`
+	Ref           string     `json:"ref"`
+	WebURL        string     `json:"web_url"`
+	User          gitLabUser `json:"user"`
+	CreatedAt     string     `json:"created_at"`
+	StartedAt     string     `json:"started_at"`
+	FinishedAt    string     `json:"finished_at"`
+}
+
+// DownloadGitLabJobResults downloads the jobs of the most recent pipelines of a GitLab project.
+// Start and Limit are applied to the pipelines and not to the jobs since a pipeline can have
+// any number of jobs.
+func DownloadGitLabJobResults(params GitLabDownloadParams) *DownloadReport {
+	validateGitLab(params)
+	writer := newDownloadWriter(newOutputLayout(params.DownloadDirPath, params.OutputTemplate, params.Compression,
+		"gitlab", "gitlab", params.Username, params.RepositoryName, params.BranchName))
+
+	downloadInChunks(params.Start, params.Limit, maxGitLabPerPage, func(start int, limit int) bool {
+		pipelines := getPagedResults[gitLabPipeline](
+			func(page int) url.URL { return constructGitLabPipelinesURL(params, page) },
+			getGitLabHeaders(params), maxGitLabPerPage, start, limit)
+		results := make([]CircleCiJobResult, 0)
+		for _, pipeline := range pipelines {
+			results = append(results, downloadGitLabPipelineJobs(params, pipeline)...)
+		}
+		writeJobResults(writer, start, limit, results)
+		return len(pipelines) == limit
+	})
+	writer.logFinished()
+	return writer.report
+}
+
+func validateGitLab(params GitLabDownloadParams) {
+	if IsEmpty(params.BaseURL) {
+		panic("GitLab URL is empty")
+	}
+	if IsEmpty(params.PrivateToken) {
+		panic("GitLab private token is empty")
+	}
+	if IsEmpty(params.Username) || IsEmpty(params.RepositoryName) {
+		panic("Both username(namespace) and repository name are required for GitLab")
+	}
+	validateStartAndLimit(params.Start, params.Limit)
+	validateOutputTemplate(params.OutputTemplate)
+}
+
+func downloadGitLabPipelineJobs(params GitLabDownloadParams, pipeline gitLabPipeline) []CircleCiJobResult {
+	jobs := getPagedResults[gitLabJob](
+		func(page int) url.URL { return constructGitLabJobsURL(params, pipeline.ID, page) },
+		getGitLabHeaders(params), maxGitLabPerPage, 0, math.MaxInt)
+	// Pipelines without a name, the default, are grouped by what triggered them, like "push" or "schedule".
+	workflowName := pipeline.Name
+	if len(workflowName) == 0 {
+		workflowName = pipeline.Source
+	}
+	results := make([]CircleCiJobResult, 0, len(jobs))
+	for _, job := range jobs {
+		results = append(results, CircleCiJobResult{
+			Username:    *params.Username,
+			Reponame:    *params.RepositoryName,
+			Branch:      job.Ref,
+			BuildNumber: job.ID,
+			BuildURL:    job.WebURL,
+			VcsRevision: pipeline.Sha,
+			Status:      getGitLabJobStatus(job.Status, job.FailureReason),
+			// Jobs of the later stages are created along with the pipeline.
+			QueuedTime: job.CreatedAt,
+			StartTime:  job.StartedAt,
+			EndTime:    job.FinishedAt,
+			User:       CircleCiUser{Login: job.User.Username, Name: job.User.Name},
+			// Jobs of the same pipeline are grouped like the jobs of a Circle CI workflow.
+			Workflows: CircleCiJobWorkflow{
+				JobName:      job.Name,
+				WorkflowID:   strconv.Itoa(pipeline.ID),
+				WorkflowName: workflowName}})
+	}
+	return results
+}
+
+// Maps GitLab job status to the closest Circle CI job status, the failed jobs are further
+// told apart by the failure reason.
+// https://docs.gitlab.com/ee/api/jobs.html
+// https://docs.gitlab.com/ee/ci/yaml/#retrywhen
+func getGitLabJobStatus(status string, failureReason string) JobStatusType {
+	switch status {
+	case "success":
+		return JobStatusSuccess
+	case "failed":
+		return getGitLabFailedJobStatus(failureReason)
+	case "canceled":
+		return JobStatusCanceled
+	case "skipped":
+		return JobStatusNotRun
+	case "manual":
+		return JobStatusNotRunning
+	case "running":
+		return JobStatusRunning
+	case "created", "pending", "preparing", "waiting_for_resource":
+		return JobStatusQueued
+	case "scheduled":
+		return JobStatusScheduled
+	default:
+		LogWarn("Unexpected GitLab job status", "status", status)
+		return JobStatusType(status)
+	}
+}
+
+func getGitLabFailedJobStatus(failureReason string) JobStatusType {
+	switch failureReason {
+	case "stuck_or_timeout_failure", "job_execution_timeout":
+		return JobStatusTimedOut
+	case "runner_system_failure", "scheduler_failure", "api_failure", "data_integrity_failure":
+		return JobStatusInfrastructureFail
+	default:
+		return JobStatusFailed
+	}
+}
+
+func getGitLabHeaders(params GitLabDownloadParams) map[string]string {
+	return map[string]string{"PRIVATE-TOKEN": *params.PrivateToken}
+}
+
+func getGitLabProjectURL(params GitLabDownloadParams) string {
+	projectID := fmt.Sprintf("%s/%s", *params.Username, *params.RepositoryName)
+	return fmt.Sprintf("%s/api/v4/projects/%s",
+		strings.TrimSuffix(*params.BaseURL, "/"),
+		url.PathEscape(projectID))
+}
+
+// https://docs.gitlab.com/ee/api/pipelines.html#list-project-pipelines
+func constructGitLabPipelinesURL(params GitLabDownloadParams, page int) url.URL {
+	v := url.Values{}
+	v.Set("page", strconv.Itoa(page))
+	v.Set("per_page", strconv.Itoa(maxGitLabPerPage))
+	if !IsEmpty(params.BranchName) {
+		v.Set("ref", *params.BranchName)
+	}
+	return parseURL(fmt.Sprintf("%s/pipelines?%s", getGitLabProjectURL(params), v.Encode()))
+}
+
+// https://docs.gitlab.com/ee/api/jobs.html#list-pipeline-jobs
+func constructGitLabJobsURL(params GitLabDownloadParams, pipelineID int, page int) url.URL {
+	v := url.Values{}
+	v.Set("page", strconv.Itoa(page))
+	v.Set("per_page", strconv.Itoa(maxGitLabPerPage))
+	return parseURL(fmt.Sprintf("%s/pipelines/%d/jobs?%s", getGitLabProjectURL(params), pipelineID, v.Encode()))
+}
+
+func parseURL(urlString string) url.URL {
+	parsedURL, err := url.Parse(urlString)
+	if err != nil {
+		panic("Failed parse url " + urlString)
+	}
+	return *parsedURL
+}
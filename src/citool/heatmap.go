@@ -0,0 +1,158 @@
+package citool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// HeatmapParams are used for configuring the weekday x hour heatmaps.
+type HeatmapParams struct {
+	// If non-empty, the heatmap cells are written to this file as JSON.
+	OutputFilePath string
+}
+
+// HeatmapCell is the aggregated information of the jobs started in an hour of a weekday.
+type HeatmapCell struct {
+	Weekday      string `json:"weekday"`
+	Hour         int    `json:"hour"`
+	JobCount     int    `json:"jobs"`
+	FailureCount int    `json:"failures"`
+	// Percentage of the failures among the succeeded or failed jobs.
+	FailureRate           int     `json:"failure_rate"`
+	MedianDurationSeconds float64 `json:"median_duration_seconds"`
+	successCount          int
+	durations             []float64
+}
+
+// Monday first
+var heatmapWeekdays = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+// heatmapAggregator counts the jobs in the heatmap cells one at a time.
+type heatmapAggregator struct {
+	params          HeatmapParams
+	location        *time.Location
+	failureStatuses []JobStatusType
+	cells           [7][24]*HeatmapCell
+}
+
+func newHeatmapAggregator(params HeatmapParams, location *time.Location,
+	failureStatuses []JobStatusType) *heatmapAggregator {
+	aggregator := &heatmapAggregator{params: params, location: location, failureStatuses: failureStatuses}
+	for i, weekday := range heatmapWeekdays {
+		for hour := 0; hour < 24; hour++ {
+			aggregator.cells[i][hour] = &HeatmapCell{Weekday: weekday.String(), Hour: hour}
+		}
+	}
+	return aggregator
+}
+
+func (aggregator *heatmapAggregator) addResult(result CircleCiJobResult) {
+	if len(result.StartTime) == 0 {
+		return
+	}
+	startTime := getTime(result.StartTime).In(aggregator.location)
+	// time.Sunday is 0
+	cell := aggregator.cells[(int(startTime.Weekday())+6)%7][startTime.Hour()]
+	cell.JobCount++
+	if result.Status.IsSuccess() {
+		cell.successCount++
+	} else if containsJobStatus(aggregator.failureStatuses, result.Status) {
+		cell.FailureCount++
+	} else {
+		return
+	}
+	if len(result.EndTime) > 0 {
+		cell.durations = append(cell.durations, getJobDuration(result).Seconds())
+	}
+}
+
+func (aggregator *heatmapAggregator) print() {
+	cells := aggregator.cells
+	for _, weekdayCells := range cells {
+		for _, cell := range weekdayCells {
+			if cell.successCount+cell.FailureCount > 0 {
+				cell.FailureRate = 100 * cell.FailureCount / (cell.successCount + cell.FailureCount)
+			}
+			if len(cell.durations) > 0 {
+				sort.Float64s(cell.durations)
+				cell.MedianDurationSeconds = getPercentile(cell.durations, 50)
+			}
+		}
+	}
+	fmt.Printf("Heatmaps of the jobs by the start time in %s\n\n", aggregator.location)
+	printHeatmap("Jobs", cells, func(cell *HeatmapCell) string {
+		return fmt.Sprintf("%d", cell.JobCount)
+	})
+	printHeatmap("Failure rate (%)", cells, func(cell *HeatmapCell) string {
+		if cell.successCount+cell.FailureCount == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%d", cell.FailureRate)
+	})
+	printHeatmap("Median duration (minutes)", cells, func(cell *HeatmapCell) string {
+		if len(cell.durations) == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f", cell.MedianDurationSeconds/60)
+	})
+	if len(aggregator.params.OutputFilePath) > 0 {
+		writeHeatmapFile(aggregator.params.OutputFilePath, cells)
+	}
+}
+
+// Cells without any job, or without the jobs the value is computed from, are printed as "-".
+func printHeatmap(title string, cells [7][24]*HeatmapCell, getValue func(cell *HeatmapCell) string) {
+	fmt.Println(title)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprint(writer, "\t")
+	for hour := 0; hour < 24; hour++ {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%02d\t", hour)
+	}
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "")
+	for i, weekday := range heatmapWeekdays {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t", weekday.String()[:3])
+		for _, cell := range cells[i] {
+			value := "-"
+			if cell.JobCount > 0 {
+				value = getValue(cell)
+			}
+			//noinspection GoUnhandledErrorResult
+			fmt.Fprintf(writer, "%s\t", value)
+		}
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintln(writer, "")
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+	fmt.Println("")
+}
+
+// writeHeatmapFile writes the non-empty cells as a JSON array.
+func writeHeatmapFile(filename string, cells [7][24]*HeatmapCell) {
+	values := make([]*HeatmapCell, 0)
+	for _, weekdayCells := range cells {
+		for _, cell := range weekdayCells {
+			if cell.JobCount > 0 {
+				values = append(values, cell)
+			}
+		}
+	}
+	contents, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to convert heatmap to JSON, error: %s", err))
+	}
+	err2 := writeToFile(filename, contents)
+	if err2 != nil {
+		panic(fmt.Sprintf("Failed to write heatmap to %s, error: %s", filename, err2))
+	}
+	LogInfo("Wrote heatmap", "file", filename, "cells", len(values))
+}
@@ -0,0 +1,271 @@
+package citool
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CompressionType is the compression of the downloaded pages.
+type CompressionType string
+
+// Values of the compression.
+const (
+	CompressionNone CompressionType = "none"
+	CompressionGzip CompressionType = "gzip"
+	CompressionZstd CompressionType = "zstd"
+)
+
+// GetCompressionOrFail converts the string value to enum type.
+// Panics if the string value does not match any enum value.
+func GetCompressionOrFail(compression string) CompressionType {
+	switch compression {
+	case string(CompressionNone), "":
+		return CompressionNone
+	case string(CompressionGzip):
+		return CompressionGzip
+	case string(CompressionZstd):
+		return CompressionZstd
+	default:
+		panic("Unexpected compression value: " + compression)
+	}
+}
+
+func (compression CompressionType) getExtension() string {
+	switch compression {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func (compression CompressionType) compress(contents []byte) []byte {
+	switch compression {
+	case CompressionGzip:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		_, err := writer.Write(contents)
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Failed to compress with gzip, error: %s", err))
+		}
+		return buffer.Bytes()
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to compress with zstd, error: %s", err))
+		}
+		//noinspection GoUnhandledErrorResult
+		defer encoder.Close()
+		return encoder.EncodeAll(contents, nil)
+	default:
+		return contents
+	}
+}
+
+// Magic bytes at the start of the compressed streams.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Tar archives have "ustar" at this offset of the first header.
+const tarMagicOffset = 257
+
+var tarMagic = []byte("ustar")
+
+// StdinInputPath is the input path for reading from stdin.
+const StdinInputPath = "-"
+
+// Files with these suffixes, optionally followed by ".gz" or ".zst", are picked from the directories,
+// any other file is ignored.
+var inputFileSuffixes = []string{".json", ".jsonl", ".ndjson", ".tar", ".tgz"}
+
+// Sub-directories of the download directory containing the test results and the failure logs.
+const (
+	TestResultsDirName = "tests"
+	FailureLogsDirName = "logs"
+)
+
+// Sub-directories written by the download mode which do not contain job results.
+var skippedInputDirs = []string{TestResultsDirName, FailureLogsDirName}
+
+// ExpandInputPaths returns the input files matching the paths. Glob patterns are expanded
+// and the directories are walked recursively for the files with one of the input file suffixes,
+// skipping their "tests" and "logs" sub-directories.
+func ExpandInputPaths(paths []string) []string {
+	files := make([]string, 0)
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		if path == StdinInputPath {
+			files = append(files, path)
+			continue
+		}
+		matches := []string{path}
+		if _, err := os.Stat(path); err != nil && strings.ContainsAny(path, "*?[") {
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				panic(fmt.Sprintf("Invalid glob pattern \"%s\": %s", path, err))
+			}
+			if len(matches) == 0 {
+				panic(fmt.Sprintf("No files match \"%s\"", path))
+			}
+		}
+		for _, match := range matches {
+			if dirExists(match) {
+				files = append(files, getInputFilesInDir(match)...)
+			} else {
+				files = append(files, match)
+			}
+		}
+	}
+	return files
+}
+
+func getInputFilesInDir(dirname string) []string {
+	files := make([]string, 0)
+	err := filepath.WalkDir(dirname, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			// Only the sub-directories written by the download mode, a repository could be named "logs"
+			if filepath.Dir(path) == filepath.Clean(dirname) && isSkippedInputDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isInputFile(entry.Name()) {
+			LogDebug("Found input file", "dir", dirname, "file", path)
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read directory \"%s\": %s", dirname, err))
+	}
+	// WalkDir is lexical already, sort anyway to have stable outcome
+	sort.Strings(files)
+	return files
+}
+
+func isInputFile(filename string) bool {
+	filename = strings.TrimSuffix(filename, CompressionGzip.getExtension())
+	filename = strings.TrimSuffix(filename, CompressionZstd.getExtension())
+	for _, suffix := range inputFileSuffixes {
+		if strings.HasSuffix(filename, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSkippedInputDir(dirname string) bool {
+	for _, skippedDir := range skippedInputDirs {
+		if dirname == skippedDir {
+			return true
+		}
+	}
+	return false
+}
+
+// Tar entries are read if they are input files outside the skipped directories.
+func isInputArchiveEntry(name string) bool {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(name)), "/")
+	for _, part := range parts[:len(parts)-1] {
+		if isSkippedInputDir(part) {
+			return false
+		}
+	}
+	return isInputFile(parts[len(parts)-1])
+}
+
+func dirExists(dirname string) bool {
+	fileInfo, err := os.Stat(dirname)
+	if err != nil {
+		return false
+	}
+	return fileInfo.IsDir()
+}
+
+// readInputFile calls callback with every JSON document of filename. The file can be plain,
+// gzip or zstd compressed JSON or a tar archive of such files, detected by the magic bytes
+// irrespective of the file name. The name passed to the callback is "archive.tar.gz:entry.json"
+// for the archive entries. StdinInputPath reads from stdin.
+func readInputFile(filename string, callback func(name string, reader io.Reader)) {
+	if filename == StdinInputPath {
+		readInput("stdin", os.Stdin, callback)
+		return
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read file \"%s\"", filename))
+	}
+	//noinspection GoUnhandledErrorResult
+	defer file.Close()
+	readInput(filename, file, callback)
+}
+
+func readInput(name string, reader io.Reader, callback func(name string, reader io.Reader)) {
+	bufferedReader := bufio.NewReader(reader)
+	header, _ := bufferedReader.Peek(len(zstdMagic))
+	if bytes.HasPrefix(header, gzipMagic) {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to decompress %s with gzip: %s", name, err))
+		}
+		//noinspection GoUnhandledErrorResult
+		defer gzipReader.Close()
+		readInput(name, gzipReader, callback)
+		return
+	}
+	if bytes.HasPrefix(header, zstdMagic) {
+		zstdReader, err := zstd.NewReader(bufferedReader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			panic(fmt.Sprintf("Failed to decompress %s with zstd: %s", name, err))
+		}
+		defer zstdReader.Close()
+		readInput(name, zstdReader, callback)
+		return
+	}
+	header, _ = bufferedReader.Peek(tarMagicOffset + len(tarMagic))
+	if len(header) == tarMagicOffset+len(tarMagic) && bytes.Equal(header[tarMagicOffset:], tarMagic) {
+		readTarArchive(name, bufferedReader, callback)
+		return
+	}
+	callback(name, bufferedReader)
+}
+
+func readTarArchive(name string, reader io.Reader, callback func(name string, reader io.Reader)) {
+	tarReader := tar.NewReader(reader)
+	for {
+		entry, err := tarReader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Failed to read archive %s: %s", name, err))
+		}
+		if entry.Typeflag != tar.TypeReg || !isInputArchiveEntry(entry.Name) {
+			continue
+		}
+		LogDebug("Reading archive entry", "file", name, "entry", entry.Name)
+		readInput(name+":"+entry.Name, tarReader, callback)
+	}
+}
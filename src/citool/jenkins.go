@@ -0,0 +1,227 @@
+package citool
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// JenkinsDownloadParams are used for configuring parameters for downloading data from Jenkins.
+type JenkinsDownloadParams struct {
+	BaseURL         *string
+	User            *string
+	APIToken        *string
+	JobName         *string
+	Start           int
+	Limit           int
+	DownloadDirPath string
+	Compression     CompressionType
+	OutputTemplate  string
+}
+
+// Number of the builds downloaded in a single Jenkins request and written to a page.
+const maxJenkinsBuildsPerPage = 100
+
+const jenkinsMultiBranchProjectClass = "org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject"
+
+type jenkinsJob struct {
+	Class     string         `json:"_class"`
+	Name      string         `json:"name"`
+	Jobs      []jenkinsJob   `json:"jobs"`
+	AllBuilds []jenkinsBuild `json:"allBuilds"`
+}
+
+type jenkinsBuild struct {
+	Number    int             `json:"number"`
+	URL       string          `json:"url"`
+	Result    *string         `json:"result"`
+	Building  bool            `json:"building"`
+	Timestamp int64           `json:"timestamp"` // in milliseconds since epoch
+	Duration  int64           `json:"duration"`  // in milliseconds
+	Actions   []jenkinsAction `json:"actions"`
+}
+
+// Only the time in the queue is read from the actions of a build, which is added by the Metrics plugin.
+// https://plugins.jenkins.io/metrics/
+type jenkinsAction struct {
+	QueuingDurationMillis int64 `json:"queuingDurationMillis"`
+}
+
+// DownloadJenkinsJobResults downloads the build history of a Jenkins job.
+// If the job is a folder or a multibranch pipeline then all the jobs inside it are walked
+// recursively. Start and Limit are applied to the builds of every job individually, so every job
+// is written to its own pages, see getJenkinsOutputTemplate.
+func DownloadJenkinsJobResults(params JenkinsDownloadParams) *DownloadReport {
+	validateJenkins(params)
+	jobPath := strings.Split(strings.Trim(*params.JobName, "/"), "/")
+	report := &DownloadReport{}
+	downloadJenkinsJob(params, jobPath, "", report)
+	LogInfo("Downloading finished", "provider", "jenkins", "job", *params.JobName,
+		"pages", report.PageCount, "records", report.RecordCount)
+	return report
+}
+
+// getJenkinsOutputTemplate returns the output template with the path of the job as a directory,
+// unless the template contains {repo} already, since the pages of all the jobs have the same start and end.
+func getJenkinsOutputTemplate(template string) string {
+	if len(template) == 0 {
+		template = DefaultOutputTemplate
+	}
+	repoPlaceholder := "{" + outputPlaceholderRepo + "}"
+	if strings.Contains(template, repoPlaceholder) {
+		return template
+	}
+	return repoPlaceholder + "/" + template
+}
+
+func validateJenkins(params JenkinsDownloadParams) {
+	if IsEmpty(params.BaseURL) {
+		panic("Jenkins URL is empty")
+	}
+	if IsEmpty(params.User) || IsEmpty(params.APIToken) {
+		panic("Both Jenkins user and API token are required")
+	}
+	if IsEmpty(params.JobName) {
+		panic("Jenkins job name is empty")
+	}
+	validateStartAndLimit(params.Start, params.Limit)
+	validateOutputTemplate(params.OutputTemplate)
+}
+
+// downloadJenkinsJob writes the builds of the job to pages and walks the jobs inside it.
+// branchName is non-empty only for the branch jobs of a multibranch pipeline.
+func downloadJenkinsJob(params JenkinsDownloadParams, jobPath []string, branchName string, report *DownloadReport) {
+	// Every job, and every branch of a multibranch pipeline, is a repository of its own since
+	// the build numbers are unique only within a job.
+	repositoryName := strings.Join(jobPath, "/")
+	var branch *string
+	if len(branchName) > 0 {
+		branch = &branchName
+	}
+	writer := downloadWriter{report: report, layout: newOutputLayout(params.DownloadDirPath,
+		getJenkinsOutputTemplate(params.OutputTemplate), params.Compression, "jenkins", "jenkins",
+		nil, &repositoryName, branch)}
+
+	var job jenkinsJob
+	downloadInChunks(params.Start, params.Limit, maxJenkinsBuildsPerPage, func(start int, limit int) bool {
+		job = getJenkinsJob(params, jobPath, start, limit)
+		// Folders and multibranch pipelines don't have builds of their own
+		if len(job.Jobs) > 0 && len(job.AllBuilds) == 0 {
+			return false
+		}
+		writeJobResults(writer, start, limit, getJenkinsJobResults(job, jobPath, branchName))
+		return len(job.AllBuilds) == limit
+	})
+
+	for _, childJob := range job.Jobs {
+		childJobPath := append(append([]string{}, jobPath...), childJob.Name)
+		if job.Class == jenkinsMultiBranchProjectClass {
+			// Children of a multibranch pipeline are branches of the same job, their names are
+			// URL-encoded branch names.
+			childBranchName, err := url.PathUnescape(childJob.Name)
+			if err != nil {
+				childBranchName = childJob.Name
+			}
+			downloadJenkinsJob(params, childJobPath, childBranchName, report)
+		} else {
+			downloadJenkinsJob(params, childJobPath, branchName, report)
+		}
+	}
+}
+
+func getJenkinsJob(params JenkinsDownloadParams, jobPath []string, start int, limit int) jenkinsJob {
+	jobURL := constructJenkinsJobURL(params, jobPath, start, limit)
+	LogDebug("Downloading job", "url", jobURL.String())
+	data, err := getBodyWithHeaders(jobURL, getJenkinsHeaders(params))
+	if err != nil {
+		panic(fmt.Sprintf("Failed to download from %s, error: %s", jobURL.String(), err))
+	}
+	var job jenkinsJob
+	err2 := json.Unmarshal(data, &job)
+	if err2 != nil {
+		panic("Failed to extract JSON" + err2.Error())
+	}
+	return job
+}
+
+func getJenkinsJobResults(job jenkinsJob, jobPath []string, branchName string) []CircleCiJobResult {
+	repositoryName := strings.Join(jobPath, "/")
+	jobName := repositoryName
+	if len(branchName) > 0 {
+		// Branch is reported separately, so, the job name is that of the multibranch pipeline.
+		jobName = strings.Join(jobPath[:len(jobPath)-1], "/")
+	}
+	results := make([]CircleCiJobResult, 0, len(job.AllBuilds))
+	for _, build := range job.AllBuilds {
+		startTime := time.UnixMilli(build.Timestamp).UTC()
+		result := CircleCiJobResult{
+			Reponame:    repositoryName,
+			Branch:      branchName,
+			BuildNumber: build.Number,
+			BuildURL:    build.URL,
+			Status:      getJenkinsBuildStatus(build),
+			StartTime:   startTime.Format(time.RFC3339Nano),
+			Workflows:   CircleCiJobWorkflow{JobName: jobName}}
+		// The duration is zero until the build finishes
+		if !build.Building {
+			endTime := startTime.Add(time.Duration(build.Duration) * time.Millisecond)
+			result.EndTime = endTime.Format(time.RFC3339Nano)
+		}
+		for _, action := range build.Actions {
+			if action.QueuingDurationMillis > 0 {
+				queuedTime := startTime.Add(-time.Duration(action.QueuingDurationMillis) * time.Millisecond)
+				result.QueuedTime = queuedTime.Format(time.RFC3339Nano)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Maps Jenkins build result to the closest Circle CI job status.
+// https://javadoc.jenkins.io/hudson/model/Result.html
+func getJenkinsBuildStatus(build jenkinsBuild) JobStatusType {
+	if build.Result == nil {
+		if build.Building {
+			return JobStatusRunning
+		}
+		return JobStatusQueued
+	}
+	switch *build.Result {
+	case "SUCCESS":
+		return JobStatusSuccess
+	case "FAILURE", "UNSTABLE":
+		return JobStatusFailed
+	case "ABORTED":
+		return JobStatusCanceled
+	case "NOT_BUILT":
+		return JobStatusNotRun
+	default:
+		LogWarn("Unexpected Jenkins build result", "result", *build.Result)
+		return JobStatusType(strings.ToLower(*build.Result))
+	}
+}
+
+func getJenkinsHeaders(params JenkinsDownloadParams) map[string]string {
+	credentials := fmt.Sprintf("%s:%s", *params.User, *params.APIToken)
+	return map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))}
+}
+
+// https://www.jenkins.io/doc/book/using/remote-access-api/
+func constructJenkinsJobURL(params JenkinsDownloadParams, jobPath []string, start int, limit int) url.URL {
+	baseURL := strings.TrimSuffix(*params.BaseURL, "/")
+	for _, name := range jobPath {
+		baseURL = fmt.Sprintf("%s/job/%s", baseURL, url.PathEscape(name))
+	}
+	// "allBuilds" unlike "builds" is not limited to the 100 most recent builds.
+	tree := fmt.Sprintf(
+		"_class,jobs[name],allBuilds[number,url,result,building,timestamp,duration,actions[queuingDurationMillis]]{%d,%d}",
+		start, start+limit)
+	v := url.Values{}
+	v.Set("tree", tree)
+	return parseURL(fmt.Sprintf("%s/api/json?%s", baseURL, v.Encode()))
+}
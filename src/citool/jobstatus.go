@@ -50,3 +50,43 @@ const (
 	JobStatusFixed              JobStatusType = "fixed"
 	JobStatusSuccess            JobStatusType = "success"
 )
+
+// AllJobStatuses are all the valid job status values.
+var AllJobStatuses = []JobStatusType{
+	JobStatusRetried,
+	JobStatusCanceled,
+	JobStatusInfrastructureFail,
+	JobStatusTimedOut,
+	JobStatusNotRun,
+	JobStatusRunning,
+	JobStatusFailed,
+	JobStatusQueued,
+	JobStatusScheduled,
+	JobStatusNotRunning,
+	JobStatusNoTests,
+	JobStatusFixed,
+	JobStatusSuccess,
+}
+
+// GetJobStatusOrFail converts the string value to enum type.
+// Panics if the string value does not match any enum value.
+func GetJobStatusOrFail(status string) JobStatusType {
+	if !containsJobStatus(AllJobStatuses, JobStatusType(status)) {
+		panic("Unexpected job status value: " + status)
+	}
+	return JobStatusType(status)
+}
+
+// IsSuccess returns true if the job succeeded, "fixed" is a success after a failure.
+func (status JobStatusType) IsSuccess() bool {
+	return status == JobStatusSuccess || status == JobStatusFixed
+}
+
+func containsJobStatus(statuses []JobStatusType, status JobStatusType) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
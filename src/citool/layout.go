@@ -0,0 +1,155 @@
+package citool
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultOutputTemplate writes the pages directly to the download directory.
+const DefaultOutputTemplate = "from-{start}-to-{end}.json"
+
+// Placeholder used in place of the empty values, like the branch when all the branches are downloaded.
+const emptyOutputPathValue = "all"
+
+var outputTemplatePlaceholderRegex = regexp.MustCompile(`\{([a-z]+)}`)
+
+// Placeholders of the output template.
+const (
+	outputPlaceholderProvider = "provider"
+	outputPlaceholderVcs      = "vcs"
+	outputPlaceholderUsername = "username"
+	outputPlaceholderRepo     = "repo"
+	outputPlaceholderBranch   = "branch"
+	outputPlaceholderDate     = "date"
+	outputPlaceholderStart    = "start"
+	outputPlaceholderEnd      = "end"
+)
+
+// outputLayout decides the path of every downloaded page from the output template, like
+// "{vcs}/{username}/{repo}/{branch}/{date}/page-{start}.json".
+type outputLayout struct {
+	DirPath     string
+	Template    string
+	Compression CompressionType
+	// Values of the placeholders other than start and end.
+	values map[string]string
+}
+
+func newOutputLayout(dirPath string, template string, compression CompressionType,
+	provider string, vcs string, username *string, repositoryName *string, branchName *string) outputLayout {
+	if len(template) == 0 {
+		template = DefaultOutputTemplate
+	}
+	values := map[string]string{
+		outputPlaceholderProvider: provider,
+		outputPlaceholderVcs:      vcs,
+		// The builds of a page can be of any date
+		outputPlaceholderDate: time.Now().Format("2006-01-02"),
+	}
+	for name, value := range map[string]*string{
+		outputPlaceholderUsername: username,
+		outputPlaceholderRepo:     repositoryName,
+		outputPlaceholderBranch:   branchName} {
+		if !IsEmpty(value) {
+			values[name] = *value
+		}
+	}
+	return outputLayout{DirPath: dirPath, Template: template, Compression: compression, values: values}
+}
+
+// validateOutputTemplate panics if the template contains an unknown placeholder or
+// if it does not contain {start} or {end}, since then all the pages would be written to the same file.
+func validateOutputTemplate(template string) {
+	if len(template) == 0 {
+		return
+	}
+	hasRange := false
+	for _, match := range outputTemplatePlaceholderRegex.FindAllStringSubmatch(template, -1) {
+		switch match[1] {
+		case outputPlaceholderStart, outputPlaceholderEnd:
+			hasRange = true
+		case outputPlaceholderProvider, outputPlaceholderVcs, outputPlaceholderUsername, outputPlaceholderRepo,
+			outputPlaceholderBranch, outputPlaceholderDate:
+		default:
+			panic(fmt.Sprintf("Unknown placeholder \"%s\" in the output template \"%s\"", match[0], template))
+		}
+	}
+	if !hasRange {
+		panic(fmt.Sprintf("Output template \"%s\" must contain {start} or {end}", template))
+	}
+	// Otherwise the analyze mode does not find the pages in the directories
+	if !strings.HasSuffix(template, ".json") {
+		panic(fmt.Sprintf("Output template \"%s\" must end with \".json\"", template))
+	}
+	if filepath.IsAbs(template) {
+		panic(fmt.Sprintf("Output template \"%s\" must be relative to the download directory", template))
+	}
+}
+
+// getFilename returns the path of the page of the results from start to start+limit-1.
+// Slashes in the values, like in "feature/foo" branch, are replaced with "-" so that every
+// value is a single directory level.
+func (layout outputLayout) getFilename(start int, limit int) string {
+	filename := outputTemplatePlaceholderRegex.ReplaceAllStringFunc(layout.Template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		switch name {
+		case outputPlaceholderStart:
+			return strconv.Itoa(start)
+		case outputPlaceholderEnd:
+			return strconv.Itoa(start + limit - 1)
+		}
+		return getOutputPathValue(layout.values[name])
+	})
+	return filepath.Join(layout.DirPath, filepath.FromSlash(filename)) + layout.Compression.getExtension()
+}
+
+// getOutputPathValue returns the value as a single directory level, see getFilename.
+func getOutputPathValue(value string) string {
+	if len(value) == 0 || value == "." || value == ".." {
+		return emptyOutputPathValue
+	}
+	return strings.NewReplacer("/", "-", "\\", "-").Replace(value)
+}
+
+// getLogArgs returns the provider, the username, the repository and the branch of the downloaded pages,
+// the ones which are set, as the fields of the download logs.
+func (layout outputLayout) getLogArgs() []any {
+	args := make([]any, 0)
+	for _, name := range []string{outputPlaceholderProvider, outputPlaceholderUsername, outputPlaceholderRepo, outputPlaceholderBranch} {
+		if value, present := layout.values[name]; present {
+			args = append(args, name, value)
+		}
+	}
+	return args
+}
+
+// getBuildFilesDir returns the directory of the files of the build other than the job result, like the
+// test results, under dirPath. The builds of every repository have their own directory, so that the
+// repositories downloaded to the same directory don't overwrite each other's files.
+func getBuildFilesDir(dirPath string, result CircleCiJobResult) string {
+	return filepath.Join(dirPath, getOutputPathValue(result.Username), getOutputPathValue(result.Reponame))
+}
+
+// getBuildFilename returns the name of the files of the job in getBuildFilesDir without the extension,
+// which is the build number, followed by the job id for the jobs sharing the build number, like "123-<job id>".
+func getBuildFilename(result CircleCiJobResult) string {
+	if len(result.JobID) == 0 {
+		return strconv.Itoa(result.BuildNumber)
+	}
+	return fmt.Sprintf("%d-%s", result.BuildNumber, result.JobID)
+}
+
+// parseBuildFilename returns the build filename of a "<build number>[-<job id>]" directory or
+// a "<build number>[-<job id>].json" file, see getBuildFilename.
+func parseBuildFilename(name string) (string, bool) {
+	buildNumberString, jobID, hasJobID := strings.Cut(strings.TrimSuffix(name, ".json"), "-")
+	buildNumber, err := strconv.Atoi(buildNumberString)
+	if err != nil || (hasJobID && len(jobID) == 0) {
+		return "", false
+	}
+	return getBuildFilename(CircleCiJobResult{BuildNumber: buildNumber, JobID: jobID}), true
+}
@@ -1,18 +1,96 @@
 package citool
 
-import "fmt"
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
 
-var debugMode = true
+// Formats of the logs
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
 
-// SetDebugMode enables/disables dbeug enable mode which enables debug logging.
-func SetDebugMode(newMode bool) {
-	debugMode = newMode
+// Logs are written to stderr to keep them out of the reports written to stdout.
+var logger = newLogger(os.Stderr, slog.LevelInfo, LogFormatText)
+
+// Values like the access tokens which are replaced in the log lines, see RegisterSecret.
+var secrets = make([]string, 0)
+
+// SetLogging sets the minimum level and the format, "text" or "json", of the logs.
+func SetLogging(level slog.Level, format string) {
+	logger = newLogger(os.Stderr, level, format)
+}
+
+// GetLogLevelOrFail converts "debug", "info", "warn" or "error" to the log level.
+// Panics if the string value does not match any log level.
+func GetLogLevelOrFail(level string) slog.Level {
+	var logLevel slog.Level
+	err := logLevel.UnmarshalText([]byte(level))
+	if err != nil {
+		panic("Unexpected log level: " + level)
+	}
+	return logLevel
+}
+
+func newLogger(writer io.Writer, level slog.Level, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	switch format {
+	case LogFormatText:
+		return slog.New(slog.NewTextHandler(writer, options))
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(writer, options))
+	default:
+		panic("Unexpected log format: " + format)
+	}
+}
+
+// redactAttr redacts the secrets from the message and the string and error fields.
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(RedactSecrets(attr.Value.String()))
+	case slog.KindAny:
+		if err, isError := attr.Value.Any().(error); isError {
+			attr.Value = slog.StringValue(RedactSecrets(err.Error()))
+		}
+	}
+	return attr
 }
 
-// LogDebug logs if debug mode is enabled. NO-OP otherwise.
-func LogDebug(msg string) {
-	if !debugMode {
-		return
+// RegisterSecret makes sure that secret is never logged.
+func RegisterSecret(secret string) {
+	if len(secret) > 0 {
+		secrets = append(secrets, secret)
 	}
-	fmt.Println(msg)
+}
+
+// RedactSecrets replaces the registered secrets in msg.
+func RedactSecrets(msg string) string {
+	for _, secret := range secrets {
+		msg = strings.ReplaceAll(msg, secret, "********")
+	}
+	return msg
+}
+
+// LogDebug logs msg with the key-value pairs in args as the fields, like LogDebug("Downloading", "url", url).
+func LogDebug(msg string, args ...any) {
+	logger.Debug(msg, args...)
+}
+
+// LogInfo is same as LogDebug but at the info level.
+func LogInfo(msg string, args ...any) {
+	logger.Info(msg, args...)
+}
+
+// LogWarn is same as LogDebug but at the warn level.
+func LogWarn(msg string, args ...any) {
+	logger.Warn(msg, args...)
+}
+
+// LogError is same as LogDebug but at the error level.
+func LogError(msg string, args ...any) {
+	logger.Error(msg, args...)
 }
@@ -0,0 +1,157 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// CircleCiPullRequest encapsulates the relevant portions of a pull request of a Circle CI build.
+type CircleCiPullRequest struct {
+	HeadSha string `json:"head_sha"`
+	URL     string `json:"url"`
+}
+
+type aggregatePullRequestInfo struct {
+	URL    string
+	Branch string
+	// Number of workflow runs
+	RunCount int
+	// Number of workflow runs till the first fully green one, zero if none of them was green.
+	AttemptsToGreen int
+	// Sum of the time from the start of the first job to the end of the last job of every workflow run.
+	WallClockTime time.Duration
+	Cost          float64
+}
+
+func getPullRequestInfo(results []CircleCiJobResult, costModel *CostModel) []*aggregatePullRequestInfo {
+	pullRequestResults := make(map[string][]CircleCiJobResult)
+	for _, result := range results {
+		for _, pullRequest := range result.PullRequests {
+			pullRequestResults[pullRequest.URL] = append(pullRequestResults[pullRequest.URL], result)
+		}
+	}
+
+	values := make([]*aggregatePullRequestInfo, 0, len(pullRequestResults))
+	for url, value := range pullRequestResults {
+		info := &aggregatePullRequestInfo{URL: url, Branch: value[0].Branch}
+		workflowResults := make(map[string][]CircleCiJobResult)
+		for _, result := range value {
+			workflowResults[result.Workflows.WorkflowID] = append(workflowResults[result.Workflows.WorkflowID], result)
+			if costModel != nil {
+				info.Cost += costModel.GetCost(result)
+			}
+		}
+		workflows := make([]workflowRun, 0, len(workflowResults))
+		for _, workflowResult := range workflowResults {
+			workflows = append(workflows, getWorkflowRun(workflowResult))
+		}
+		// chronological order
+		sort.Slice(workflows, func(i, j int) bool {
+			return workflows[i].StartTime.Before(workflows[j].StartTime)
+		})
+		info.RunCount = len(workflows)
+		for i, workflow := range workflows {
+			info.WallClockTime += workflow.Duration
+			if workflow.IsGreen && info.AttemptsToGreen == 0 {
+				info.AttemptsToGreen = i + 1
+			}
+		}
+		values = append(values, info)
+	}
+	return values
+}
+
+type workflowRun struct {
+	StartTime time.Time
+	Duration  time.Duration
+	IsGreen   bool
+}
+
+func getWorkflowRun(workflowResults []CircleCiJobResult) workflowRun {
+	_, isGreen := getTimeToGreen(workflowResults)
+	run := workflowRun{Duration: getWallClockTime(workflowResults), IsGreen: isGreen}
+	for _, result := range workflowResults {
+		if len(result.StartTime) == 0 {
+			continue
+		}
+		startTime := getTime(result.StartTime)
+		if run.StartTime.IsZero() || startTime.Before(run.StartTime) {
+			run.StartTime = startTime
+		}
+	}
+	return run
+}
+
+// Returns the time from the start of the first job to the end of the last job.
+func getWallClockTime(results []CircleCiJobResult) time.Duration {
+	var firstStartTime, lastEndTime time.Time
+	for _, result := range results {
+		if len(result.StartTime) == 0 || len(result.EndTime) == 0 {
+			continue
+		}
+		startTime := getTime(result.StartTime)
+		endTime := getTime(result.EndTime)
+		if firstStartTime.IsZero() || startTime.Before(firstStartTime) {
+			firstStartTime = startTime
+		}
+		if endTime.After(lastEndTime) {
+			lastEndTime = endTime
+		}
+	}
+	return lastEndTime.Sub(firstStartTime)
+}
+
+func printPullRequestStats(results []CircleCiJobResult, costModel *CostModel) {
+	values := getPullRequestInfo(results, costModel)
+	if len(values) == 0 {
+		fmt.Println("No jobs with pull requests found")
+		return
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Cost != values[j].Cost {
+			// Most expensive first
+			return values[i].Cost > values[j].Cost
+		}
+		if values[i].WallClockTime != values[j].WallClockTime {
+			return values[i].WallClockTime > values[j].WallClockTime
+		}
+		// Sort on the basis of URL to have stable outcome
+		return values[i].URL < values[j].URL
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprint(writer, "Pull request\tBranch\tRuns\tAttempts to green\tWall-clock time")
+	if costModel != nil {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprint(writer, "\tCredits")
+	}
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprint(writer, "\n------------\t------\t----\t-----------------\t---------------")
+	if costModel != nil {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprint(writer, "\t-------")
+	}
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "")
+	for _, v := range values {
+		attemptsToGreen := "never green"
+		if v.AttemptsToGreen > 0 {
+			attemptsToGreen = fmt.Sprintf("%d", v.AttemptsToGreen)
+		}
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s",
+			v.URL, v.Branch, v.RunCount, attemptsToGreen, v.WallClockTime.Round(time.Second))
+		if costModel != nil {
+			//noinspection GoUnhandledErrorResult
+			fmt.Fprintf(writer, "\t%.0f", v.Cost)
+		}
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintln(writer, "")
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
@@ -0,0 +1,161 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// failureStreak is a run of consecutive failures of a job on a branch.
+type failureStreak struct {
+	FailureCount int
+	// Start of the first failure.
+	StartTime time.Time
+	// End of the first successful run after the failures, zero if the job is still failing.
+	RecoveryTime time.Time
+	// Revision of the first successful run after the failures.
+	FixRevision string
+}
+
+func (streak failureStreak) isRecovered() bool {
+	return !streak.RecoveryTime.IsZero()
+}
+
+type jobRecoveryInfo struct {
+	Branch  string
+	JobName string
+	Streaks []failureStreak
+}
+
+// Returns the mean and the max time to recovery of the recovered streaks.
+func (info jobRecoveryInfo) getTimeToRecovery() (time.Duration, time.Duration) {
+	totalDuration := time.Duration(0)
+	maxDuration := time.Duration(0)
+	recoveredCount := 0
+	for _, streak := range info.Streaks {
+		if !streak.isRecovered() {
+			continue
+		}
+		duration := streak.RecoveryTime.Sub(streak.StartTime)
+		totalDuration += duration
+		if duration > maxDuration {
+			maxDuration = duration
+		}
+		recoveredCount++
+	}
+	if recoveredCount == 0 {
+		return 0, 0
+	}
+	return totalDuration / time.Duration(recoveredCount), maxDuration
+}
+
+// The first one is returned if there are multiple longest streaks.
+func (info jobRecoveryInfo) getLongestStreak() failureStreak {
+	longestStreak := info.Streaks[0]
+	for _, streak := range info.Streaks[1:] {
+		if streak.FailureCount > longestStreak.FailureCount {
+			longestStreak = streak
+		}
+	}
+	return longestStreak
+}
+
+// getJobRecoveryInfo walks the chronologically ordered results of every job on every branch
+// and finds the streaks of consecutive failures.
+func getJobRecoveryInfo(results []CircleCiJobResult, failureStatuses []JobStatusType) []*jobRecoveryInfo {
+	jobResults := make(map[string][]CircleCiJobResult)
+	for _, result := range results {
+		if !result.Status.IsSuccess() && !containsJobStatus(failureStatuses, result.Status) {
+			continue
+		}
+		if len(result.StartTime) == 0 || len(result.EndTime) == 0 {
+			continue
+		}
+		key := result.Branch + "\x00" + result.Workflows.JobName
+		jobResults[key] = append(jobResults[key], result)
+	}
+
+	values := make([]*jobRecoveryInfo, 0)
+	for _, value := range jobResults {
+		// chronological order
+		sort.Slice(value, func(i, j int) bool {
+			return getTime(value[i].StartTime).Before(getTime(value[j].StartTime))
+		})
+		info := &jobRecoveryInfo{Branch: value[0].Branch, JobName: value[0].Workflows.JobName}
+		var currentStreak *failureStreak
+		for _, result := range value {
+			if !result.Status.IsSuccess() {
+				if currentStreak == nil {
+					currentStreak = &failureStreak{StartTime: getTime(result.StartTime)}
+				}
+				currentStreak.FailureCount++
+				continue
+			}
+			if currentStreak != nil {
+				currentStreak.RecoveryTime = getTime(result.EndTime)
+				currentStreak.FixRevision = result.VcsRevision
+				info.Streaks = append(info.Streaks, *currentStreak)
+				currentStreak = nil
+			}
+		}
+		// Job is still failing
+		if currentStreak != nil {
+			info.Streaks = append(info.Streaks, *currentStreak)
+		}
+		if len(info.Streaks) > 0 {
+			values = append(values, info)
+		}
+	}
+	return values
+}
+
+func printJobRecovery(results []CircleCiJobResult, failureStatuses []JobStatusType) {
+	values := getJobRecoveryInfo(results, failureStatuses)
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Branch != values[j].Branch {
+			return values[i].Branch < values[j].Branch
+		}
+		meanDuration1, _ := values[i].getTimeToRecovery()
+		meanDuration2, _ := values[j].getTimeToRecovery()
+		if meanDuration1 != meanDuration2 {
+			// Slowest to recover first
+			return meanDuration1 > meanDuration2
+		}
+		// Sort on the basis of name to have stable outcome
+		return values[i].JobName < values[j].JobName
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Branch\tJob name\tBreakages\tMean time to recovery\tMax time to recovery\tLongest streak\tFixed by")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "------\t--------\t---------\t---------------------\t--------------------\t--------------\t--------")
+	for _, v := range values {
+		meanDuration, maxDuration := v.getTimeToRecovery()
+		longestStreak := v.getLongestStreak()
+		fixRevision := "still failing"
+		if longestStreak.isRecovered() {
+			fixRevision = getShortRevision(longestStreak.FixRevision)
+		}
+		meanTimeToRecovery, maxTimeToRecovery := "-", "-"
+		if maxDuration > 0 {
+			meanTimeToRecovery = meanDuration.Round(time.Second).String()
+			maxTimeToRecovery = maxDuration.Round(time.Second).String()
+		}
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\t%d\t%s\n",
+			v.Branch, v.JobName, len(v.Streaks), meanTimeToRecovery, maxTimeToRecovery,
+			longestStreak.FailureCount, fixRevision)
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
+
+func getShortRevision(revision string) string {
+	if len(revision) > 7 {
+		return revision[:7]
+	}
+	return revision
+}
@@ -0,0 +1,97 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// DownloadReport summarizes the files written by a download.
+type DownloadReport struct {
+	PageCount   int
+	RecordCount int
+	// Number of the other files, like the test results and the failure logs.
+	FileCount int
+	// Bytes written to the pages and the other files, after the compression.
+	ByteCount int64
+	// Files which could not be written, the download fails if there is any.
+	FailedWrites []FailedWrite
+}
+
+// FailedWrite is a file which could not be written.
+type FailedWrite struct {
+	Filename string
+	Error    error
+}
+
+// HasFailures returns true if any of the files could not be written.
+func (report *DownloadReport) HasFailures() bool {
+	return len(report.FailedWrites) > 0
+}
+
+// Print prints the number of the pages, records and bytes written followed by the files
+// which could not be written.
+func (report *DownloadReport) Print() {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Pages\tRecords\tOther files\tBytes\tFailed writes")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "-----\t-------\t-----------\t-----\t-------------")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintf(writer, "%d\t%d\t%d\t%d\t%d\n",
+		report.PageCount, report.RecordCount, report.FileCount, report.ByteCount, len(report.FailedWrites))
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+	if !report.HasFailures() {
+		return
+	}
+	fmt.Printf("\nFailed to write %d files\n", len(report.FailedWrites))
+	for _, failedWrite := range report.FailedWrites {
+		fmt.Printf("%s: %s\n", failedWrite.Filename, failedWrite.Error)
+	}
+}
+
+// downloadWriter writes the downloaded pages and the other files, and records them in the report.
+// Write failures do not stop the download so that all of them are reported at the end.
+type downloadWriter struct {
+	layout outputLayout
+	report *DownloadReport
+}
+
+func newDownloadWriter(layout outputLayout) downloadWriter {
+	return downloadWriter{layout: layout, report: &DownloadReport{}}
+}
+
+// writePage writes a page of recordCount results from start to start+limit-1.
+func (writer downloadWriter) writePage(start int, limit int, data []byte, recordCount int) {
+	filename := writer.layout.getFilename(start, limit)
+	if writer.write(filename, writer.layout.Compression.compress(data)) {
+		writer.report.PageCount++
+		writer.report.RecordCount += recordCount
+	}
+}
+
+// writeFile writes a file other than a page, the file is not compressed.
+func (writer downloadWriter) writeFile(filename string, contents []byte) {
+	if writer.write(filename, contents) {
+		writer.report.FileCount++
+	}
+}
+
+// logFinished logs the pages and the records written so far.
+func (writer downloadWriter) logFinished() {
+	LogInfo("Downloading finished", append(writer.layout.getLogArgs(),
+		"pages", writer.report.PageCount, "records", writer.report.RecordCount)...)
+}
+
+func (writer downloadWriter) write(filename string, contents []byte) bool {
+	err := writeToFile(filename, contents)
+	if err != nil {
+		LogError("Failed to write file", append(writer.layout.getLogArgs(), "file", filename, "error", err)...)
+		writer.report.FailedWrites = append(writer.report.FailedWrites, FailedWrite{Filename: filename, Error: err})
+		return false
+	}
+	LogInfo("Wrote file", append(writer.layout.getLogArgs(), "file", filename, "bytes", len(contents))...)
+	writer.report.ByteCount += int64(len(contents))
+	return true
+}
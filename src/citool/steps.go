@@ -0,0 +1,121 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type aggregateStepInfo struct {
+	StepName string
+	// Order of the step in the job, used for printing steps with same duration.
+	Index     int
+	Durations []float64 // in seconds
+}
+
+// Duration of a step is that of the slowest of its parallel actions.
+func (step CircleCiJobStep) getDuration() time.Duration {
+	maxRunTimeMillis := int64(0)
+	for _, action := range step.Actions {
+		if action.RunTimeMillis > maxRunTimeMillis {
+			maxRunTimeMillis = action.RunTimeMillis
+		}
+	}
+	return time.Duration(maxRunTimeMillis) * time.Millisecond
+}
+
+// stepDurationAggregator collects the step durations of the jobs one at a time.
+type stepDurationAggregator struct {
+	jobSteps      map[string]map[string]*aggregateStepInfo
+	jobBuildCount map[string]int
+}
+
+func newStepDurationAggregator() *stepDurationAggregator {
+	return &stepDurationAggregator{
+		jobSteps:      make(map[string]map[string]*aggregateStepInfo),
+		jobBuildCount: make(map[string]int)}
+}
+
+func (aggregator *stepDurationAggregator) addResult(result CircleCiJobResult) {
+	// Only consider successful jobs to avoid skew due to failed job which might fail early on.
+	if result.Status != JobStatusSuccess || len(result.Steps) == 0 {
+		return
+	}
+	jobName := result.Workflows.JobName
+	aggregator.jobBuildCount[jobName]++
+	if _, present := aggregator.jobSteps[jobName]; !present {
+		aggregator.jobSteps[jobName] = make(map[string]*aggregateStepInfo)
+	}
+	for i, step := range result.Steps {
+		stepInfo, present := aggregator.jobSteps[jobName][step.Name]
+		if !present {
+			stepInfo = &aggregateStepInfo{StepName: step.Name, Index: i}
+			aggregator.jobSteps[jobName][step.Name] = stepInfo
+		}
+		stepInfo.Durations = append(stepInfo.Durations, step.getDuration().Seconds())
+	}
+}
+
+func (aggregator *stepDurationAggregator) print() {
+	fmt.Printf("Printing job step durations\n")
+	jobSteps := aggregator.jobSteps
+	jobBuildCount := aggregator.jobBuildCount
+	if len(jobSteps) == 0 {
+		fmt.Printf("No steps found, download the build details to get them\n\n")
+		return
+	}
+
+	jobNames := make([]string, 0, len(jobSteps))
+	for jobName := range jobSteps {
+		jobNames = append(jobNames, jobName)
+	}
+	sort.Strings(jobNames)
+	for _, jobName := range jobNames {
+		steps := make([]*aggregateStepInfo, 0, len(jobSteps[jobName]))
+		totalDuration := float64(0)
+		for _, stepInfo := range jobSteps[jobName] {
+			sort.Float64s(stepInfo.Durations)
+			totalDuration += sum(stepInfo.Durations)
+			steps = append(steps, stepInfo)
+		}
+		sort.Slice(steps, func(i, j int) bool {
+			median1 := getPercentile(steps[i].Durations, 50)
+			median2 := getPercentile(steps[j].Durations, 50)
+			if median1 != median2 {
+				// Slowest step first
+				return median1 > median2
+			}
+			return steps[i].Index < steps[j].Index
+		})
+
+		fmt.Printf("\nJob name: %s (%d builds)\n\n", jobName, jobBuildCount[jobName])
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintln(writer, "Step name\tp50\tp90\tp99\tShare of job duration")
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintln(writer, "---------\t---\t---\t---\t---------------------")
+		for _, v := range steps {
+			share := 0
+			if totalDuration > 0 {
+				share = int(100 * sum(v.Durations) / totalDuration)
+			}
+			//noinspection GoUnhandledErrorResult
+			fmt.Fprintf(writer, "%s\t%v\t%v\t%v\t%d%%\n",
+				v.StepName,
+				getStepDuration(getPercentile(v.Durations, 50)),
+				getStepDuration(getPercentile(v.Durations, 90)),
+				getStepDuration(getPercentile(v.Durations, 99)),
+				share)
+		}
+		//noinspection GoUnhandledErrorResult
+		writer.Flush()
+	}
+	fmt.Println("")
+}
+
+func getStepDuration(seconds float64) time.Duration {
+	// We don't need accuracy below one second.
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second)
+}
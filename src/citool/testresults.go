@@ -0,0 +1,364 @@
+package citool
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TestResultType represents the outcome of a single test case.
+type TestResultType string
+
+// These are same as the values used by Circle CI test metadata.
+// https://circleci.com/docs/api/#get-build-tests
+const (
+	TestResultSuccess TestResultType = "success"
+	TestResultFailure TestResultType = "failure"
+	TestResultSkipped TestResultType = "skipped"
+)
+
+// TestCaseResult is the result of a single test case in a build.
+type TestCaseResult struct {
+	ClassName string         `json:"classname"`
+	Name      string         `json:"name"`
+	File      string         `json:"file"`
+	Result    TestResultType `json:"result"`
+	RunTime   float64        `json:"run_time"` // in seconds
+	Message   string         `json:"message"`
+}
+
+// FullName returns the name which uniquely identifies the test case.
+func (testCaseResult TestCaseResult) FullName() string {
+	if len(testCaseResult.ClassName) == 0 {
+		return testCaseResult.Name
+	}
+	return testCaseResult.ClassName + "." + testCaseResult.Name
+}
+
+// Circle CI returns "error" as well which is treated as a failure.
+func (testCaseResult TestCaseResult) failed() bool {
+	return testCaseResult.Result != TestResultSuccess && testCaseResult.Result != TestResultSkipped
+}
+
+type circleCiTestMetadata struct {
+	Tests []TestCaseResult `json:"tests"`
+}
+
+// https://github.com/testmoapp/junitxml
+type junitTestSuite struct {
+	TestSuites []junitTestSuite `xml:"testsuite"`
+	TestCases  []junitTestCase  `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	File      string        `xml:"file,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+}
+
+// TestResults are the test results of the builds, see GetTestResults.
+type TestResults struct {
+	// True for the legacy layout with the builds directly in the test results directory.
+	isFlat bool
+	// Keyed by "<username>/<reponame>/<build number>", or by the build number in the flat layout.
+	builds map[string][]TestCaseResult
+}
+
+// Get returns the test results of the job. In the flat layout, the builds of all the repositories
+// with the same build number share the test results.
+func (testResults TestResults) Get(result CircleCiJobResult) []TestCaseResult {
+	key := getBuildFilename(result)
+	if !testResults.isFlat {
+		key = filepath.Join(getBuildFilesDir("", result), key)
+	}
+	return testResults.builds[key]
+}
+
+// GetTestResults reads the test results of the builds stored in testResultsDir under
+// "<username>/<reponame>/" like the download mode stores them, or directly in testResultsDir
+// if any of its entries is named after a build number.
+// The test results of a build are either JUnit XML files anywhere under "<build number>/"
+// or the Circle CI test metadata stored in "<build number>.json" by the download mode.
+func GetTestResults(testResultsDir string) TestResults {
+	testResults := TestResults{builds: make(map[string][]TestCaseResult)}
+	entries := readDir(testResultsDir)
+	for _, entry := range entries {
+		if _, isBuild := parseBuildFilename(entry.Name()); isBuild {
+			testResults.isFlat = true
+		}
+	}
+	if testResults.isFlat {
+		testResults.readBuilds(testResultsDir, "")
+	} else {
+		for _, userEntry := range entries {
+			if !userEntry.IsDir() {
+				continue
+			}
+			userDirPath := filepath.Join(testResultsDir, userEntry.Name())
+			for _, repoEntry := range readDir(userDirPath) {
+				if repoEntry.IsDir() {
+					testResults.readBuilds(filepath.Join(userDirPath, repoEntry.Name()),
+						filepath.Join(userEntry.Name(), repoEntry.Name()))
+				}
+			}
+		}
+	}
+	LogDebug("Found test results", "dir", testResultsDir, "flat", testResults.isFlat, "builds", len(testResults.builds))
+	return testResults
+}
+
+// readBuilds reads the test results of the builds in dirPath, relPath is "<username>/<reponame>"
+// or empty in the flat layout.
+func (testResults TestResults) readBuilds(dirPath string, relPath string) {
+	for _, entry := range readDir(dirPath) {
+		path := filepath.Join(dirPath, entry.Name())
+		buildFilename, isBuild := parseBuildFilename(entry.Name())
+		if !isBuild {
+			LogDebug("Ignoring test results not named after a build number", "file", path)
+			continue
+		}
+		key := filepath.Join(relPath, buildFilename)
+		if entry.IsDir() {
+			testResults.builds[key] = append(testResults.builds[key], getJUnitTestResults(path)...)
+		} else if strings.HasSuffix(entry.Name(), ".json") {
+			testResults.builds[key] = append(testResults.builds[key], getCircleCiTestResults(path)...)
+		}
+	}
+}
+
+func readDir(dirPath string) []os.DirEntry {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read directory \"%s\"", dirPath))
+	}
+	return entries
+}
+
+func getCircleCiTestResults(filename string) []TestCaseResult {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read file \"%s\"", filename))
+	}
+	var testMetadata circleCiTestMetadata
+	err2 := json.Unmarshal(contents, &testMetadata)
+	if err2 != nil {
+		panic(fmt.Sprintf("Failed to extract JSON from %s: %s", filename, err2))
+	}
+	return testMetadata.Tests
+}
+
+func getJUnitTestResults(dirPath string) []TestCaseResult {
+	testResults := make([]TestCaseResult, 0)
+	err := filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".xml") {
+			return nil
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// The root element is either <testsuites> or <testsuite>, both are parsed the same way.
+		var testSuite junitTestSuite
+		err = xml.Unmarshal(contents, &testSuite)
+		if err != nil {
+			return fmt.Errorf("failed to parse JUnit XML %s: %w", path, err)
+		}
+		testResults = append(testResults, testSuite.getTestResults()...)
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Failed to read test results from %s, error: %s", dirPath, err))
+	}
+	return testResults
+}
+
+func (testSuite junitTestSuite) getTestResults() []TestCaseResult {
+	testResults := make([]TestCaseResult, 0, len(testSuite.TestCases))
+	for _, testCase := range testSuite.TestCases {
+		testResult := TestCaseResult{
+			ClassName: testCase.ClassName,
+			Name:      testCase.Name,
+			File:      testCase.File,
+			Result:    TestResultSuccess}
+		// Time is optional
+		if runTime, err := strconv.ParseFloat(testCase.Time, 64); err == nil {
+			testResult.RunTime = runTime
+		}
+		if testCase.Failure != nil {
+			testResult.Result = TestResultFailure
+			testResult.Message = testCase.Failure.Message
+		} else if testCase.Error != nil {
+			testResult.Result = TestResultFailure
+			testResult.Message = testCase.Error.Message
+		} else if testCase.Skipped != nil {
+			testResult.Result = TestResultSkipped
+		}
+		testResults = append(testResults, testResult)
+	}
+	for _, childTestSuite := range testSuite.TestSuites {
+		testResults = append(testResults, childTestSuite.getTestResults()...)
+	}
+	return testResults
+}
+
+// testCaseRun is what is needed from a test case result for the test statistics.
+type testCaseRun struct {
+	StartTime   time.Time
+	VcsRevision string
+	Failed      bool
+	RunTime     float64 // in seconds
+}
+
+type aggregateTestInfo struct {
+	TestName    string
+	JobName     string
+	Runs        []testCaseRun
+	RunCount    int
+	FailedCount int
+	FlipCount   int
+	Durations   []float64 // in seconds, sorted
+}
+
+func (info aggregateTestInfo) failureRate() float64 {
+	return float64(info.FailedCount) / float64(info.RunCount)
+}
+
+// Fraction of consecutive runs in which the result changed from pass to fail or vice versa.
+func (info aggregateTestInfo) flakiness() float64 {
+	if info.RunCount < 2 {
+		return 0
+	}
+	return float64(info.FlipCount) / float64(info.RunCount-1)
+}
+
+// printTestStats prints per-test failure rate, flakiness and duration percentiles.
+func printTestStats(aggregateInfos []*aggregateTestInfo) {
+	sort.Slice(aggregateInfos, func(i, j int) bool {
+		if aggregateInfos[i].failureRate() != aggregateInfos[j].failureRate() {
+			// Most failing test first
+			return aggregateInfos[i].failureRate() > aggregateInfos[j].failureRate()
+		}
+		if aggregateInfos[i].flakiness() != aggregateInfos[j].flakiness() {
+			return aggregateInfos[i].flakiness() > aggregateInfos[j].flakiness()
+		}
+		// Sort on the basis of name to have stable outcome
+		if aggregateInfos[i].JobName != aggregateInfos[j].JobName {
+			return aggregateInfos[i].JobName < aggregateInfos[j].JobName
+		}
+		return aggregateInfos[i].TestName < aggregateInfos[j].TestName
+	})
+
+	fmt.Printf("Number of test results: %d\n", getTestRunCount(aggregateInfos))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "Test name\tJob name\tFailure Rate\tFlakiness\tp50\tp90\tp99")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "---------\t--------\t------------\t---------\t---\t---\t---")
+	for _, v := range aggregateInfos {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%s\t%d/%d (%d%%)\t%d%%\t%v\t%v\t%v\n",
+			v.TestName, v.JobName, v.FailedCount, v.RunCount, int(100*v.failureRate()),
+			int(100*v.flakiness()),
+			getTestDuration(getPercentile(v.Durations, 50)),
+			getTestDuration(getPercentile(v.Durations, 90)),
+			getTestDuration(getPercentile(v.Durations, 99)))
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+}
+
+// testStatsAggregator collects the runs of every test case per job from the test results of
+// the jobs one at a time, skipped tests are ignored.
+type testStatsAggregator struct {
+	aggregateInfo map[string]*aggregateTestInfo
+	values        []*aggregateTestInfo
+}
+
+func newTestStatsAggregator() *testStatsAggregator {
+	return &testStatsAggregator{aggregateInfo: make(map[string]*aggregateTestInfo)}
+}
+
+func (aggregator *testStatsAggregator) addResult(result CircleCiJobResult) {
+	if len(result.Tests) == 0 || len(result.StartTime) == 0 {
+		return
+	}
+	jobName := result.Workflows.JobName
+	startTime := getTime(result.StartTime)
+	for _, test := range result.Tests {
+		if test.Result == TestResultSkipped {
+			continue
+		}
+		key := jobName + "\x00" + test.FullName()
+		info, present := aggregator.aggregateInfo[key]
+		if !present {
+			info = &aggregateTestInfo{TestName: test.FullName(), JobName: jobName}
+			aggregator.aggregateInfo[key] = info
+		}
+		info.Runs = append(info.Runs, testCaseRun{
+			StartTime:   startTime,
+			VcsRevision: result.VcsRevision,
+			Failed:      test.failed(),
+			RunTime:     test.RunTime})
+	}
+}
+
+// getAggregateTestInfo returns the aggregated information of every test case per job,
+// computed once after all the results are added.
+func (aggregator *testStatsAggregator) getAggregateTestInfo() []*aggregateTestInfo {
+	if aggregator.values != nil {
+		return aggregator.values
+	}
+	values := make([]*aggregateTestInfo, 0, len(aggregator.aggregateInfo))
+	for _, info := range aggregator.aggregateInfo {
+		// chronological order
+		sort.Slice(info.Runs, func(i, j int) bool {
+			return info.Runs[i].StartTime.Before(info.Runs[j].StartTime)
+		})
+		info.RunCount = len(info.Runs)
+		for i, run := range info.Runs {
+			if run.Failed {
+				info.FailedCount++
+			}
+			if i > 0 && run.Failed != info.Runs[i-1].Failed {
+				info.FlipCount++
+			}
+			info.Durations = append(info.Durations, run.RunTime)
+		}
+		sort.Float64s(info.Durations)
+		values = append(values, info)
+	}
+	aggregator.values = values
+	return values
+}
+
+func getTestRunCount(aggregateInfos []*aggregateTestInfo) int {
+	count := 0
+	for _, info := range aggregateInfos {
+		count += info.RunCount
+	}
+	return count
+}
+
+func getTestDuration(seconds float64) time.Duration {
+	// We don't need accuracy below one millisecond.
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
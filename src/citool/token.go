@@ -0,0 +1,38 @@
+package citool
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GetToken returns the access token from the first of these which is set
+//   - token itself, usually set with a flag
+//   - tokenFile, a file containing the token
+//   - tokenCommand, a credential helper command printing the token
+//
+// Each of them can come from a flag, the environment or the profile, see ApplySettings.
+// Leading and trailing whitespace is removed and the token is registered as a secret.
+func GetToken(token string, tokenFile string, tokenCommand string) string {
+	if len(token) == 0 && len(tokenFile) > 0 {
+		contents, err := os.ReadFile(tokenFile)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to read file \"%s\"", tokenFile))
+		}
+		token = string(contents)
+	}
+	if len(token) == 0 && len(tokenCommand) > 0 {
+		LogDebug("Getting token from credential helper", "command", tokenCommand)
+		command := exec.Command("sh", "-c", tokenCommand)
+		command.Stderr = os.Stderr
+		output, err := command.Output()
+		if err != nil {
+			panic(fmt.Sprintf("Failed to get token from \"%s\", error: %s", tokenCommand, err))
+		}
+		token = string(output)
+	}
+	token = strings.TrimSpace(token)
+	RegisterSecret(token)
+	return token
+}
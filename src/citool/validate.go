@@ -0,0 +1,318 @@
+package citool
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Fields every job result is expected to have, the analysis silently counts the missing ones as zeroes.
+var requiredJobResultFields = []string{
+	"username", "reponame", "branch", "build_num", "status", "start_time", "stop_time", "workflows"}
+
+// Timestamps which are null for the jobs which did not run.
+var jobResultTimestampFields = []string{"start_time", "stop_time"}
+
+// FileQualityReport is the data quality of the job results in an input file, or in an entry of an archive.
+type FileQualityReport struct {
+	Filename    string
+	RecordCount int
+	// Number of the records with each kind of issue.
+	MissingFieldCount    int
+	NullTimestampCount   int
+	UnknownStatusCount   int
+	StopBeforeStartCount int
+	DuplicateCount       int
+	// Invalid or truncated JSON, records which are not objects or have invalid values.
+	ErrorCount int
+	// The first issues, see DataValidator.MaxListedIssues.
+	Issues     []DataQualityIssue
+	issueCount int
+}
+
+// DataQualityIssue points at a record with an issue.
+type DataQualityIssue struct {
+	// Zero if the issue is about the whole file.
+	Line int
+	// Index of the record in the file starting from 1, zero if the issue is not about a record.
+	Record  int
+	Message string
+}
+
+// DataValidator checks the job results of the input files against the expected schema.
+// Duplicates are detected across all the files.
+type DataValidator struct {
+	// Number of the issues listed per file, the rest are only counted.
+	MaxListedIssues int
+	Reports         []*FileQualityReport
+	// Location of the first occurrence of every build.
+	builds map[string]string
+}
+
+// NewDataValidator creates a validator listing at most maxListedIssues issues per file.
+func NewDataValidator(maxListedIssues int) *DataValidator {
+	return &DataValidator{MaxListedIssues: maxListedIssues, builds: make(map[string]string)}
+}
+
+// ValidateFile checks the job results in filename, which can be anything ReadCircleCIJobResults reads.
+// Unlike the analyze mode, unreadable files are reported instead of panicking.
+func (validator *DataValidator) ValidateFile(filename string) {
+	if filename != StdinInputPath {
+		if _, err := os.Stat(filename); err != nil {
+			validator.addReport(filename).addFatalError(0, 0, fmt.Sprintf("unable to read file: %s", err))
+			return
+		}
+	}
+	// Report of the file, or of the archive entry, being read.
+	var report *FileQualityReport
+	defer func() {
+		// Like a truncated archive
+		if r := recover(); r != nil {
+			if report == nil {
+				report = validator.addReport(filename)
+			}
+			report.addFatalError(0, 0, fmt.Sprint(r))
+		}
+	}()
+	readInputFile(filename, func(name string, reader io.Reader) {
+		report = validator.addReport(name)
+		validator.validateJobResults(report, reader)
+	})
+}
+
+func (validator *DataValidator) addReport(filename string) *FileQualityReport {
+	report := &FileQualityReport{Filename: filename}
+	validator.Reports = append(validator.Reports, report)
+	report.Issues = make([]DataQualityIssue, 0, validator.MaxListedIssues)
+	return report
+}
+
+// validateJobResults reads the results the same way as readJobResults, either a sequence of
+// JSON arrays or newline-delimited JSON, and stops at the first invalid JSON.
+func (validator *DataValidator) validateJobResults(report *FileQualityReport, reader io.Reader) {
+	bufferedReader := bufio.NewReader(reader)
+	firstByte, skippedLineCount, err := skipWhitespace(bufferedReader)
+	if err == io.EOF {
+		report.addFatalError(1, 0, "no job results")
+		return
+	}
+	if err != nil {
+		report.addFatalError(1, 0, fmt.Sprintf("unable to read file: %s", err))
+		return
+	}
+	lines := &lineCountingReader{reader: bufferedReader, line: skippedLineCount + 1}
+	decoder := json.NewDecoder(lines)
+	validateRecords := func() bool {
+		for decoder.More() {
+			var record json.RawMessage
+			err := decoder.Decode(&record)
+			if err != nil {
+				report.addFatalError(lines.getLine(decoder.InputOffset()), report.RecordCount+1,
+					fmt.Sprintf("invalid JSON: %s", err))
+				return false
+			}
+			report.RecordCount++
+			line := lines.getLine(decoder.InputOffset() - int64(len(record)))
+			validator.validateRecord(report, line, record)
+		}
+		return true
+	}
+	if firstByte != '[' {
+		validateRecords()
+		return
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil || token != json.Delim('[') {
+			report.addFatalError(lines.getLine(decoder.InputOffset()), 0, "expected an array of job results")
+			return
+		}
+		if !validateRecords() {
+			return
+		}
+		_, err2 := decoder.Token()
+		if err2 != nil {
+			report.addFatalError(lines.getLine(decoder.InputOffset()), 0, fmt.Sprintf("invalid JSON: %s", err2))
+			return
+		}
+	}
+}
+
+func (validator *DataValidator) validateRecord(report *FileQualityReport, line int, record json.RawMessage) {
+	recordIndex := report.RecordCount
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(record, &fields) != nil {
+		report.addError(line, recordIndex, "job result is not a JSON object")
+		return
+	}
+	var result CircleCiJobResult
+	err := json.Unmarshal(record, &result)
+	if err != nil {
+		report.addError(line, recordIndex, fmt.Sprintf("invalid value: %s", err))
+		return
+	}
+
+	missingFields := make([]string, 0)
+	for _, field := range requiredJobResultFields {
+		if _, present := fields[field]; !present {
+			missingFields = append(missingFields, field)
+		}
+	}
+	if len(missingFields) > 0 {
+		report.MissingFieldCount++
+		report.addIssue(line, recordIndex, "missing "+strings.Join(missingFields, ", "))
+	}
+
+	nullFields := make([]string, 0)
+	for _, field := range jobResultTimestampFields {
+		if value, present := fields[field]; present && (string(value) == "null" || string(value) == `""`) {
+			nullFields = append(nullFields, field)
+		}
+	}
+	if len(nullFields) > 0 {
+		report.NullTimestampCount++
+		report.addIssue(line, recordIndex,
+			fmt.Sprintf("null %s of job with status \"%s\"", strings.Join(nullFields, ", "), result.Status))
+	}
+	startTime, isStartTimeValid := validateTimestamp(report, line, recordIndex, "start_time", result.StartTime)
+	endTime, isEndTimeValid := validateTimestamp(report, line, recordIndex, "stop_time", result.EndTime)
+	if isStartTimeValid && isEndTimeValid && endTime.Before(startTime) {
+		report.StopBeforeStartCount++
+		report.addIssue(line, recordIndex,
+			fmt.Sprintf("stop_time %s is before start_time %s", result.EndTime, result.StartTime))
+	}
+
+	if _, present := fields["status"]; present && !containsJobStatus(AllJobStatuses, result.Status) {
+		report.UnknownStatusCount++
+		report.addIssue(line, recordIndex, fmt.Sprintf("unknown status \"%s\"", result.Status))
+	}
+
+	if _, present := fields["build_num"]; present {
+		build := fmt.Sprintf("%s/%s/%s", result.Username, result.Reponame, getBuildFilename(result))
+		location := fmt.Sprintf("%s:%d (record %d)", report.Filename, line, recordIndex)
+		if firstLocation, seen := validator.builds[build]; seen {
+			report.DuplicateCount++
+			report.addIssue(line, recordIndex, fmt.Sprintf("duplicate of build %s at %s", build, firstLocation))
+		} else {
+			validator.builds[build] = location
+		}
+	}
+}
+
+// Empty timestamps are fine, they are reported as null timestamps.
+func validateTimestamp(report *FileQualityReport, line int, recordIndex int, field string,
+	value string) (time.Time, bool) {
+	if len(value) == 0 {
+		return time.Time{}, false
+	}
+	parsedTime, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		report.addError(line, recordIndex, fmt.Sprintf("invalid %s \"%s\"", field, value))
+		return time.Time{}, false
+	}
+	return parsedTime, true
+}
+
+func (report *FileQualityReport) addError(line int, recordIndex int, message string) {
+	report.ErrorCount++
+	report.addIssue(line, recordIndex, message)
+}
+
+// addFatalError adds the error which stops the validation of the file, it is listed even if the
+// maximum number of the issues is already listed.
+func (report *FileQualityReport) addFatalError(line int, recordIndex int, message string) {
+	report.ErrorCount++
+	report.issueCount++
+	report.Issues = append(report.Issues, DataQualityIssue{Line: line, Record: recordIndex, Message: message})
+}
+
+func (report *FileQualityReport) addIssue(line int, recordIndex int, message string) {
+	report.issueCount++
+	if len(report.Issues) < cap(report.Issues) {
+		report.Issues = append(report.Issues, DataQualityIssue{Line: line, Record: recordIndex, Message: message})
+	}
+}
+
+// HasErrors returns true if any file has invalid JSON, or job results which do not match the
+// schema, that is with missing fields or unknown statuses. The other issues are only anomalies.
+func (validator *DataValidator) HasErrors() bool {
+	for _, report := range validator.Reports {
+		if report.ErrorCount+report.MissingFieldCount+report.UnknownStatusCount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintReport prints the issue counts per file followed by the first issues of every file.
+func (validator *DataValidator) PrintReport() {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "File\tRecords\tMissing fields\tNull timestamps\tUnknown statuses\tStop before start\tDuplicates\tErrors")
+	//noinspection GoUnhandledErrorResult
+	fmt.Fprintln(writer, "----\t-------\t--------------\t---------------\t----------------\t-----------------\t----------\t------")
+	for _, report := range validator.Reports {
+		//noinspection GoUnhandledErrorResult
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", report.Filename, report.RecordCount,
+			report.MissingFieldCount, report.NullTimestampCount, report.UnknownStatusCount,
+			report.StopBeforeStartCount, report.DuplicateCount, report.ErrorCount)
+	}
+	//noinspection GoUnhandledErrorResult
+	writer.Flush()
+
+	for _, report := range validator.Reports {
+		if report.issueCount == 0 {
+			continue
+		}
+		fmt.Println("")
+		for _, issue := range report.Issues {
+			location := report.Filename
+			if issue.Line > 0 {
+				location = fmt.Sprintf("%s:%d", location, issue.Line)
+			}
+			if issue.Record > 0 {
+				location = fmt.Sprintf("%s: record %d", location, issue.Record)
+			}
+			fmt.Printf("%s: %s\n", location, issue.Message)
+		}
+		if report.issueCount > len(report.Issues) {
+			fmt.Printf("%s: ... and %d more issues\n", report.Filename, report.issueCount-len(report.Issues))
+		}
+	}
+}
+
+// lineCountingReader converts the offsets of the JSON decoder to line numbers. Only the newlines
+// read ahead of the decoder are kept, so that a file with many lines does not need much memory.
+type lineCountingReader struct {
+	reader         io.Reader
+	offset         int64
+	newlineOffsets []int64
+	line           int
+}
+
+func (reader *lineCountingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			reader.newlineOffsets = append(reader.newlineOffsets, reader.offset+int64(i))
+		}
+	}
+	reader.offset += int64(n)
+	return n, err
+}
+
+// getLine returns the line of the offset, the offsets must not decrease between the calls.
+func (reader *lineCountingReader) getLine(offset int64) int {
+	passedCount := 0
+	for passedCount < len(reader.newlineOffsets) && reader.newlineOffsets[passedCount] < offset {
+		passedCount++
+	}
+	reader.line += passedCount
+	reader.newlineOffsets = reader.newlineOffsets[passedCount:]
+	return reader.line
+}
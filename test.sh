@@ -1,8 +1,205 @@
 #!/usr/bin/env bash
 set -euo pipefail
 
-GO111MODULE=on go run citool.go --mode analyze  --print-duration-graph=false --print-success-graph=false --input-files test/circleci_data/*.json > test/analyze_actual_output.txt
+GO111MODULE=on go run citool.go analyze --print-duration-graph=false --print-success-graph=false --input-files test/circleci_data/*.json > test/analyze_actual_output.txt
 diff test/analyze_actual_output.txt test/analyze_expected_output.txt
 rm test/analyze_actual_output.txt
 
-echo "Test 1 successful"
\ No newline at end of file
+echo "Test 1 successful"
+# Deprecated --mode flag
+GO111MODULE=on go run citool.go --mode analyze --print-success-rate=false --print-duration=false --print-duration-graph=false --print-success-graph=false --print-failure-breakdown --input-files test/circleci_data/*.json > test/failure_breakdown_actual_output.txt
+diff test/failure_breakdown_actual_output.txt test/failure_breakdown_expected_output.txt
+rm test/failure_breakdown_actual_output.txt
+
+echo "Test 2 successful"
+# CIRCLE_TOKEN overrides the token in the profile
+CIRCLE_TOKEN=env-token GO111MODULE=on go run citool.go config show --config test/config/citool.yaml | grep "circle-token" > test/config_actual_output.txt
+diff test/config_actual_output.txt test/config_expected_output.txt
+rm test/config_actual_output.txt
+
+echo "Test 3 successful"
+# Compressed files and archives in a directory, skipping its "tests" sub-directory
+GO111MODULE=on go run citool.go analyze --print-duration-graph=false --print-success-graph=false test/compressed_data > test/compressed_actual_output.txt
+diff test/compressed_actual_output.txt test/compressed_expected_output.txt
+# Glob patterns expanded by citool
+GO111MODULE=on go run citool.go analyze --print-duration-graph=false --print-success-graph=false 'test/compressed_data/*.json.*' 'test/compressed_data/archive/*' > test/compressed_actual_output.txt
+diff test/compressed_actual_output.txt test/compressed_expected_output.txt
+rm test/compressed_actual_output.txt
+
+echo "Test 4 successful"
+# Newline-delimited JSON
+GO111MODULE=on go run citool.go analyze --print-duration-graph=false --print-success-graph=false test/ndjson_data/from-500-to-699.jsonl > test/ndjson_actual_output.txt
+diff test/ndjson_actual_output.txt test/ndjson_expected_output.txt
+# Concatenated JSON arrays from stdin
+cat test/circleci_data/from-500-to-599.json test/circleci_data/from-600-to-699.json | GO111MODULE=on go run citool.go analyze --print-duration-graph=false --print-success-graph=false - > test/ndjson_actual_output.txt
+diff test/ndjson_actual_output.txt test/ndjson_expected_output.txt
+rm test/ndjson_actual_output.txt
+
+echo "Test 5 successful"
+# Data quality report, fails because of the invalid job results
+validate_status=0
+GO111MODULE=on go run citool.go validate --max-issues 5 test/invalid_data test/circleci_data/from-0-to-99.json > test/validate_actual_output.txt || validate_status=$?
+diff test/validate_actual_output.txt test/validate_expected_output.txt
+test "${validate_status}" -eq 1
+# Valid job results
+GO111MODULE=on go run citool.go validate --input-files test/circleci_data/from-100-to-199.json > /dev/null
+rm test/validate_actual_output.txt
+
+echo "Test 6 successful"
+# Downloads from the recorded provider API responses served locally, see test/fileserver
+tmp_dir=$(mktemp -d)
+server_pids=()
+trap 'kill "${server_pids[@]}" 2> /dev/null; rm -rf "${tmp_dir}"' EXIT
+GO111MODULE=on go build -o "${tmp_dir}/fileserver" ./test/fileserver
+# Starts a file server with the given flags and sets server_url
+start_fileserver() {
+  local addr_file
+  addr_file=$(mktemp -u "${tmp_dir}/addr.XXXXXX")
+  "${tmp_dir}/fileserver" --dir test/provider_data --addr-file "${addr_file}" "$@" &
+  server_pids+=($!)
+  while [ ! -f "${addr_file}" ]; do sleep 0.1; done
+  server_url="http://$(cat "${addr_file}")"
+}
+start_fileserver
+
+# GitLab jobs of the pipelines with the job statuses and the failure reasons mapped to the Circle CI job statuses
+GO111MODULE=on go run citool.go download --provider gitlab --gitlab-url "${server_url}" --gitlab-token gitlab-token --username mygroup --reponame myproject --limit 2 --download-dir "${tmp_dir}/gitlab" > /dev/null
+diff "${tmp_dir}/gitlab/from-0-to-1.json" test/gitlab_expected_output.json
+
+echo "Test 7 successful"
+# Jenkins builds of every job of a folder and of every branch of a multibranch pipeline, each job in its own directory
+GO111MODULE=on go run citool.go download --provider jenkins --jenkins-url "${server_url}" --jenkins-user jenkins-user --jenkins-token jenkins-token --jenkins-job releases --download-dir "${tmp_dir}/jenkins" > /dev/null
+(cd "${tmp_dir}/jenkins" && find . -type f | sort | while read -r file; do echo "${file}"; cat "${file}"; echo; done) > test/jenkins_actual_output.txt
+diff test/jenkins_actual_output.txt test/jenkins_expected_output.txt
+rm test/jenkins_actual_output.txt
+
+echo "Test 8 successful"
+# Buildkite jobs of the builds sharing the build number and told apart by the job id, without the wait and block steps
+GO111MODULE=on go run citool.go download --provider buildkite --buildkite-url "${server_url}" --buildkite-token buildkite-token --username myorg --reponame mypipeline --limit 2 --download-dir "${tmp_dir}/buildkite" > /dev/null
+diff "${tmp_dir}/buildkite/from-0-to-1.json" test/buildkite_expected_output.json
+# No duplicates among the jobs of the same build
+GO111MODULE=on go run citool.go validate - < "${tmp_dir}/buildkite/from-0-to-1.json" > test/buildkite_actual_output.txt
+diff test/buildkite_actual_output.txt test/buildkite_validate_expected_output.txt
+rm test/buildkite_actual_output.txt
+
+echo "Test 9 successful"
+# Reports of the analyze command on the crafted job results of test/report_data
+report_flags=(--print-success-rate=false --print-duration=false --print-duration-graph=false --print-success-graph=false)
+# Test results downloaded per repository, and JUnit XML files keyed by the build number
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-test-stats --test-results-dir test/report_data/tests test/report_data/jobs.json > test/test_stats_actual_output.txt
+diff test/test_stats_actual_output.txt test/test_stats_expected_output.txt
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-test-stats --test-results-dir test/report_data/junit test/report_data/jobs.json > test/test_stats_actual_output.txt
+diff test/test_stats_actual_output.txt test/test_stats_junit_expected_output.txt
+rm test/test_stats_actual_output.txt
+
+echo "Test 10 successful"
+# Tests passing and failing on the same revision, and the quarantine list of the flaky tests
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-flaky-tests --quarantine-file "${tmp_dir}/quarantine.txt" --test-results-dir test/report_data/tests test/report_data/jobs.json > test/flaky_tests_actual_output.txt
+diff test/flaky_tests_actual_output.txt test/flaky_tests_expected_output.txt
+diff "${tmp_dir}/quarantine.txt" test/quarantine_expected_output.txt
+rm test/flaky_tests_actual_output.txt
+
+echo "Test 11 successful"
+# Step durations of the successful builds
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-step-durations test/report_data/jobs.json > test/step_durations_actual_output.txt
+diff test/step_durations_actual_output.txt test/step_durations_expected_output.txt
+rm test/step_durations_actual_output.txt
+
+echo "Test 12 successful"
+# Failure categories of the failure logs stored per repository or by the build number, of the jobs with the failure statuses
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --failure-rules test/failure_rules.json --failure-logs-dir test/report_data/failure_logs test/report_data/jobs.json > test/failure_categories_actual_output.txt
+diff test/failure_categories_actual_output.txt test/failure_categories_expected_output.txt
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --failure-rules test/failure_rules.json --failure-logs-dir test/report_data/failure_logs --failure-statuses failed,infrastructure_fail test/report_data/jobs.json > test/failure_categories_actual_output.txt
+diff test/failure_categories_actual_output.txt test/failure_categories_statuses_expected_output.txt
+rm test/failure_categories_actual_output.txt
+
+echo "Test 13 successful"
+# Breakdown of the job statuses with the infrastructure failures told apart from the code failures
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-failure-breakdown test/report_data/jobs.json > test/failure_breakdown_actual_output.txt
+diff test/failure_breakdown_actual_output.txt test/report_failure_breakdown_expected_output.txt
+rm test/failure_breakdown_actual_output.txt
+
+echo "Test 14 successful"
+# Breakages and time to recovery of every job on every branch
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-recovery test/report_data/jobs.json > test/recovery_actual_output.txt
+diff test/recovery_actual_output.txt test/recovery_expected_output.txt
+rm test/recovery_actual_output.txt
+
+echo "Test 15 successful"
+# DORA metrics of the deploy jobs of the Circle CI job results
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-dora --deploy-job-pattern '^deploy-' test/circleci_data/*.json > test/dora_actual_output.txt
+diff test/dora_actual_output.txt test/dora_expected_output.txt
+rm test/dora_actual_output.txt
+
+echo "Test 16 successful"
+# Estimated cost per job, workflow, branch and user with the credits per minute of the resource class or the platform
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --cost-model test/cost_model.json test/report_data/jobs.json > test/cost_actual_output.txt
+diff test/cost_actual_output.txt test/cost_expected_output.txt
+rm test/cost_actual_output.txt
+
+echo "Test 17 successful"
+# Per-author statistics with the anonymized logins, and per committer email with the credits of the cost model
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-authors --anonymize test/report_data/jobs.json > test/authors_actual_output.txt
+diff test/authors_actual_output.txt test/authors_expected_output.txt
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-authors --author-key committer --cost-model test/cost_model.json test/report_data/jobs.json > test/authors_actual_output.txt
+diff test/authors_actual_output.txt test/authors_committer_expected_output.txt
+rm test/authors_actual_output.txt
+
+echo "Test 18 successful"
+# Runs and attempts till the first green workflow of the pull requests, with the credits of the cost model
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-pull-requests --cost-model test/cost_model.json test/report_data/jobs.json > test/pull_requests_actual_output.txt
+diff test/pull_requests_actual_output.txt test/pull_requests_expected_output.txt
+rm test/pull_requests_actual_output.txt
+
+echo "Test 19 successful"
+# Heatmaps in a time zone, with the cells of the jobs which neither succeeded nor failed, and the heatmap file
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-heatmaps --time-zone America/Los_Angeles --heatmap-file "${tmp_dir}/heatmap.json" test/report_data/jobs.json > test/heatmaps_actual_output.txt
+diff test/heatmaps_actual_output.txt test/heatmaps_expected_output.txt
+diff "${tmp_dir}/heatmap.json" test/heatmap_expected_output.json
+rm test/heatmaps_actual_output.txt
+
+echo "Test 20 successful"
+# Running and queued jobs per day in a time zone and their timelines
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" --print-concurrency --time-zone America/Los_Angeles test/circleci_data/*.json > test/concurrency_actual_output.txt
+diff test/concurrency_actual_output.txt test/concurrency_expected_output.txt
+rm test/concurrency_actual_output.txt
+
+echo "Test 21 successful"
+# Circle CI access token from a file, from a credential helper command and from CIRCLE_TOKEN, the server rejects the others
+start_fileserver --header Circle-Token=circle-secret
+echo circle-secret > "${tmp_dir}/circle-token"
+GO111MODULE=on go run citool.go download --circle-url "${server_url}" --circle-token-file "${tmp_dir}/circle-token" --username myorg --reponame myrepo --limit 2 --download-dir "${tmp_dir}/circleci-file" > /dev/null
+diff "${tmp_dir}/circleci-file/from-0-to-1.json" test/circleci_expected_output.json
+GO111MODULE=on go run citool.go download --circle-url "${server_url}" --circle-token-command "echo circle-secret" --username myorg --reponame myrepo --limit 2 --download-dir "${tmp_dir}/circleci-command" > /dev/null
+diff "${tmp_dir}/circleci-command/from-0-to-1.json" test/circleci_expected_output.json
+CIRCLE_TOKEN=circle-secret GO111MODULE=on go run citool.go download --circle-url "${server_url}" --username myorg --reponame myrepo --limit 2 --download-dir "${tmp_dir}/circleci-env" > /dev/null
+diff "${tmp_dir}/circleci-env/from-0-to-1.json" test/circleci_expected_output.json
+if GO111MODULE=on go run citool.go download --circle-url "${server_url}" --circle-token wrong-secret --username myorg --reponame myrepo --limit 2 --download-dir "${tmp_dir}/circleci-wrong" > /dev/null 2>&1; then
+  echo "Download with the wrong Circle CI token succeeded"
+  exit 1
+fi
+
+echo "Test 22 successful"
+# Pages written to the paths of the output template, with "all" for the branch when all the branches are downloaded
+CIRCLE_TOKEN=circle-secret GO111MODULE=on go run citool.go download --circle-url "${server_url}" --username myorg --reponame myrepo --limit 2 --compress gzip --output-template "{provider}/{vcs}/{username}/{repo}/{branch}/{date}/page-{start}-{end}.json" --download-dir "${tmp_dir}/output-template" > /dev/null
+(cd "${tmp_dir}/output-template" && find . -type f | sort) | sed "s#/$(date +%Y-%m-%d)/#/{date}/#" > test/output_template_actual_output.txt
+diff test/output_template_actual_output.txt test/output_template_expected_output.txt
+# The analyze command finds the pages in the sub-directories
+GO111MODULE=on go run citool.go analyze "${report_flags[@]}" "${tmp_dir}/output-template" > test/output_template_actual_output.txt
+test "$(cat test/output_template_actual_output.txt)" = "Number of job results: 2"
+rm test/output_template_actual_output.txt
+
+echo "Test 23 successful"
+# Download report of the pages and the test results written
+CIRCLE_TOKEN=circle-secret GO111MODULE=on go run citool.go download --circle-url "${server_url}" --username myorg --reponame myrepo --limit 2 --download-tests --download-dir "${tmp_dir}/report" 2> /dev/null > test/download_report_actual_output.txt
+diff test/download_report_actual_output.txt test/download_report_expected_output.txt
+# The page which cannot be written is reported, the test results are still written, and the download fails
+mkdir -p "${tmp_dir}/report-failure/from-0-to-1.json"
+download_status=0
+CIRCLE_TOKEN=circle-secret GO111MODULE=on go run citool.go download --circle-url "${server_url}" --username myorg --reponame myrepo --limit 2 --download-tests --download-dir "${tmp_dir}/report-failure" 2> /dev/null | sed -E -e "s#${tmp_dir}/##g" -e 's#\.[0-9]+\.tmp#.<random>.tmp#' > test/download_report_actual_output.txt || download_status=$?
+diff test/download_report_actual_output.txt test/download_report_failure_expected_output.txt
+test "${download_status}" -eq 1
+test -f "${tmp_dir}/report-failure/tests/myorg/myrepo/120.json"
+rm test/download_report_actual_output.txt
+
+echo "Test 24 successful"
@@ -0,0 +1,63 @@
+// Command fileserver serves the recorded responses of a CI provider API for test.sh, so that the
+// downloads are tested without the network. The response of a request is the file at the escaped
+// URL path with ".json" appended, like "api/v4/projects/mygroup%2Fmyproject/pipelines.json", the query
+// is ignored, so every page of a paged API is the same page.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var dir = flag.String("dir", ".", "Directory containing the responses.")
+
+var addrFile = flag.String("addr-file", "", "File to write the address listened on to, once the server is ready.")
+
+var requiredHeader = flag.String("header", "", "Request header required by every request as \"<name>=<value>\", like the access token.")
+
+func main() {
+	flag.Parse()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to listen: %s", err))
+	}
+	if len(*addrFile) > 0 {
+		// Written to a temporary file first, so that the address is never read partially.
+		tmpFile := *addrFile + ".tmp"
+		err = os.WriteFile(tmpFile, []byte(listener.Addr().String()), 0o644)
+		if err == nil {
+			err = os.Rename(tmpFile, *addrFile)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Failed to write the address to \"%s\": %s", *addrFile, err))
+		}
+	}
+	err = http.Serve(listener, http.HandlerFunc(serveResponse))
+	if err != nil {
+		panic(fmt.Sprintf("Failed to serve: %s", err))
+	}
+}
+
+func serveResponse(writer http.ResponseWriter, request *http.Request) {
+	if len(*requiredHeader) > 0 {
+		name, value, _ := strings.Cut(*requiredHeader, "=")
+		if request.Header.Get(name) != value {
+			http.Error(writer, "missing or wrong "+name, http.StatusUnauthorized)
+			return
+		}
+	}
+	filename := filepath.Join(*dir, filepath.FromSlash(request.URL.EscapedPath())+".json")
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	//noinspection GoUnhandledErrorResult
+	writer.Write(contents)
+}